@@ -3,6 +3,6 @@ package api
 type Artists []Artist
 
 type Artist struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
 }
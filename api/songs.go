@@ -3,8 +3,8 @@ package api
 type Songs []Song
 
 type Song struct {
-	Id       int    `json:"id"`
-	Name     string `json:"name"`
-	Duration string `json:"duration"`
-	ArtistId int    `json:"artistId"`
+	Id       int    `json:"id" db:"id"`
+	Name     string `json:"name" db:"name"`
+	Duration string `json:"duration" db:"duration"`
+	ArtistId int    `json:"artistId" db:"artist_id"`
 }
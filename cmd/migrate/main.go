@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/migrations"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+)
+
+const usage = `usage: migrate up|down [steps]|status [config flags]
+
+  up      applies every pending migration
+  down    rolls back the last migration, or the last steps ones
+  status  lists every migration and when it was applied
+
+The database is configured like the API, see config.H.`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	steps := 1
+	if cmd == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			steps, args = n, args[1:]
+		}
+	}
+	if err := run(cmd, steps, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd string, steps int, args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	log, err := logs.NewWithConfig(logs.Config{Level: cfg.LogLevel, Format: cfg.LogFormat})
+	if err != nil {
+		return err
+	}
+	db, err := persist.New(cfg, log)
+	if err != nil {
+		return err
+	}
+	fsys, err := migrations.For(db.Dialect().Name())
+	if err != nil {
+		return err
+	}
+	m, err := persist.NewMigrator(db, fsys)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch cmd {
+	case "up":
+		done, err := m.Up(ctx)
+		log.Info("Migrated up", logs.I{"applied": len(done)})
+		return err
+	case "down":
+		done, err := m.Down(ctx, steps)
+		log.Info("Migrated down", logs.I{"rolledBack": len(done)})
+		return err
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			at := "pending"
+			if s.Applied {
+				at = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, at)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", cmd, usage)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/flight"
+	"github.com/pclavier92/go-restful-api/pkg/gin"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+)
+
+// dbReport is what /admin/db tells about the database
+type dbReport struct {
+	Queries    []persist.QueryStat     `json:"queries"`
+	Statements persist.StmtStats       `json:"preparedStatements"`
+	Replicas   []persist.ReplicaStatus `json:"replicas"`
+	// Coalesced are the reads of each service which shared the query of another
+	Coalesced map[string]flight.Stats `json:"coalescedReads"`
+}
+
+// coalescing has how to get the coalesced reads of each service
+type coalescing map[string]func() flight.Stats
+
+func (c coalescing) stats() map[string]flight.Stats {
+	stats := map[string]flight.Stats{}
+	for name, fn := range c {
+		stats[name] = fn()
+	}
+	return stats
+}
+
+// registerAdmin serves the stats of the database in /admin, only to the
+// requests with the token. Without a token, or a database, there is no /admin.
+func registerAdmin(e *gin.Engine, db *persist.Conn, reads coalescing, token string, log logs.Printer) {
+	if token == "" || db == nil {
+		return
+	}
+	err := errors.Pkg("main", log).Struct("admin")
+	a := e.Group("/admin")
+	a.GET("/db", authorized(token, err, func(c *gin.Context) (int, interface{}, error) {
+		return 200, dbReport{db.QueryStats(), db.StmtStats(), db.Replicas(), reads.stats()}, nil
+	}))
+	a.DELETE("/db/queries", authorized(token, err, func(c *gin.Context) (int, interface{}, error) {
+		db.ResetQueryStats()
+		return 200, "reset", nil
+	}))
+}
+
+// authorized lets the request through to fn if it has the bearer token
+func authorized(token string, err errors.Structer, fn gin.Controller) gin.Controller {
+	return func(c *gin.Context) (int, interface{}, error) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return 401, nil, err.Fn("authorized").Unauthorized("wrong or missing admin token")
+		}
+		return fn(c)
+	}
+}
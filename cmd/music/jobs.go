@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pclavier92/go-restful-api/pkg/jobs"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+)
+
+// registerJobs adds every job of the app to r. They can be run once with
+// SCOPE=job-<name>, and the scheduled ones also run inside the API.
+func registerJobs(r *jobs.Runner, db persist.Querier, log logs.Printer) error {
+	all := []struct {
+		name, schedule string
+		fn             jobs.Func
+	}{
+		{"catalog-stats", "@every 1h", catalogStats(db, log)},
+		{"analyze-tables", "0 4 * * *", analyzeTables(db)},
+		{"db-stats", "@every 5m", dbStats(db, log)},
+	}
+	for _, j := range all {
+		if err := r.Register(j.name, j.schedule, j.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// catalogStats logs how many songs and artists there are
+func catalogStats(db persist.Querier, log logs.Printer) jobs.Func {
+	return func(ctx context.Context) error {
+		var songs, artists int
+		err := db.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM Songs), (SELECT COUNT(*) FROM Artists)").Scan(&songs, &artists)
+		if err != nil {
+			return err
+		}
+		log.Info("Catalog stats", logs.I{"songs": songs, "artists": artists})
+		return nil
+	}
+}
+
+// dbStats logs how well the cache of prepared statements is doing
+func dbStats(db persist.Querier, log logs.Printer) jobs.Func {
+	return func(ctx context.Context) error {
+		s := db.StmtStats()
+		log.Info("Prepared statements", logs.I{
+			"size":          s.Size,
+			"capacity":      s.Capacity,
+			"hits":          s.Hits,
+			"misses":        s.Misses,
+			"hitRate":       s.HitRate(),
+			"evictions":     s.Evictions,
+			"invalidations": s.Invalidations,
+		})
+		return nil
+	}
+}
+
+// analyzeTables refreshes the index statistics the database uses to plan queries
+func analyzeTables(db persist.Querier) jobs.Func {
+	return func(ctx context.Context) error {
+		query := "ANALYZE TABLE Songs, Artists"
+		switch db.Dialect().Name() {
+		case "postgres":
+			query = "ANALYZE Songs, Artists"
+		case "sqlite":
+			query = "ANALYZE"
+		}
+		_, err := db.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// runJob runs a single job, like a cron job or a K8s job would, and tells
+// if it went well
+func runJob(r *jobs.Runner, name string, log logs.Printer) bool {
+	log.Info("Running job", logs.I{"job": name, "jobs": r.Names()})
+	if err := r.Run(context.Background(), name); err != nil {
+		log.Error("Job did not finish", logs.I{"job": name, "error": err.Error()})
+		return false
+	}
+	return true
+}
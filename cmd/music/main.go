@@ -1,47 +1,167 @@
 package main
 
 import (
+	"flag"
+	"os"
+
+	"github.com/pclavier92/go-restful-api/api"
 	"github.com/pclavier92/go-restful-api/config"
 	"github.com/pclavier92/go-restful-api/internal/artists"
 	"github.com/pclavier92/go-restful-api/internal/songs"
+	"github.com/pclavier92/go-restful-api/pkg/cache"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
 	"github.com/pclavier92/go-restful-api/pkg/gin"
+	"github.com/pclavier92/go-restful-api/pkg/jobs"
 	"github.com/pclavier92/go-restful-api/pkg/logs"
 	"github.com/pclavier92/go-restful-api/pkg/persist"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
 	// "github.com/pclavier92/go-restful-api/intenal/users"
 )
 
 func main() {
-	cfg := config.New()
-	log, err := logs.New(cfg.Scope)
+	cfg, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		// the usage was printed already
+		os.Exit(0)
+	} else if err != nil {
+		panic(err)
+	}
+	errors.SetDebug(!cfg.Productive)
+	redactor, err := logs.NewRedactor(cfg.RedactFields, cfg.RedactPatterns)
 	if err != nil {
 		panic(err)
 	}
-	db, err := persist.New(cfg, log)
+	logs.SetRedactor(redactor)
+	log, err := logs.NewWithConfig(logs.Config{
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		Output:     cfg.LogOutput,
+		File:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+	})
+	if err != nil {
+		panic(err)
+	}
+	// with DB_DRIVER=memory there is no database at all, db stays nil
+	var db *persist.Conn
+	var locker jobs.Locker = &jobs.LocalLocker{}
+	if cfg.DBDriver != "memory" {
+		if db, err = persist.New(cfg, log); err != nil {
+			panic(err)
+		}
+		if cfg.AutoMigrate && !cfg.Job {
+			if err := migrate(db); err != nil {
+				panic(err)
+			}
+		}
+		locker = db
+	}
+	exp, err := trace.NewExporter(cfg.TraceOutput)
 	if err != nil {
 		panic(err)
 	}
-	log.Info("Starting up API", logs.I{"scope": cfg.Scope})
+	tracer := trace.New("music", exp)
+	runner := jobs.New(locker, log)
+	runner.UseTracer(tracer)
+	if db != nil {
+		if err := registerJobs(runner, db, log); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Job {
+		if !runJob(runner, cfg.JobName, log) {
+			os.Exit(1)
+		}
+		return
+	}
+	log.Info("Starting up API", logs.I{"scope": cfg.Scope, "config": cfg.Dump()})
+	if cfg.RunJobs {
+		runner.Start(nil)
+	}
 	e := gin.New(cfg.Port)
-	_, songsAPI := songs.New(db, log)
-	_, artistsAPI := artists.New(db, log)
+	e.UseTracer(tracer)
+	cors := gin.NewCORS(cfg.CORSOrigins)
+	e.UseCORS(cors)
+	watchConfig(cfg, log, db, cors)
+	var songsAPI *songs.API
+	var artistsAPI *artists.API
+	reads := coalescing{}
+	if db == nil {
+		songsAPI, artistsAPI = inMemory(log)
+	} else {
+		songsService, sAPI := songs.New(db, log)
+		artistsService, aAPI := artists.New(db, log)
+		if cfg.CacheSize > 0 {
+			store := cache.NewMemory(cfg.CacheSize)
+			opts := cache.Options{TTL: cfg.CacheTTL, MaxAge: cfg.CacheMaxAge, Primary: cfg.CachePrimary}
+			songsService.UseCache(store, opts)
+			artistsService.UseCache(store, opts)
+		}
+		songsAPI, artistsAPI = sAPI, aAPI
+		reads["songs"], reads["artists"] = songsService.Coalescing, artistsService.Coalescing
+	}
 	//_, usersAPI := users.New(db, log)
 
-	e.UseLogger()
+	e.UseAccessLog(log, cfg.AccessLogSampleRate)
+	if cfg.LogBodies {
+		e.UseBodyLog(log, 4096)
+	}
 	{
 		i := e.Group("/songs")
 		{
-			i.GET("", songsAPI.GetSongs)
-			i.GET("/:name", songsAPI.GetSongByName)
-			i.POST("/:name", songsAPI.CreateSong)
-			i.PUT("/:name", songsAPI.UpdateSong)
-			i.DELETE("/:name", songsAPI.DeleteSong)
+			i.GET("", songsAPI.GetSongs, gin.Doc{
+				Summary:   "List every song",
+				Responses: gin.Responses{200: api.Songs{}, 500: nil},
+			})
+			i.PUT("", songsAPI.SaveSongs, gin.Doc{
+				Summary:   "Create or update many songs at once, all of them or none",
+				Request:   api.Songs{},
+				Responses: gin.Responses{201: nil, 400: nil, 500: nil},
+			})
+			i.GET("/:name", songsAPI.GetSongByName, gin.Doc{
+				Summary:   "Get a song by its name",
+				Responses: gin.Responses{200: api.Song{}, 404: nil, 500: nil},
+			})
+			i.POST("/:name", songsAPI.CreateSong, gin.Doc{
+				Summary:   "Create a song, or update it if it already exists",
+				Request:   api.Song{},
+				Responses: gin.Responses{201: nil, 400: nil, 500: nil},
+			})
+			i.PUT("/:name", songsAPI.UpdateSong, gin.Doc{
+				Summary:   "Update a song, or create it if it does not exist",
+				Request:   api.Song{},
+				Responses: gin.Responses{201: nil, 400: nil, 500: nil},
+			})
+			i.DELETE("/:name", songsAPI.DeleteSong, gin.Doc{
+				Summary:   "Delete a song by its name",
+				Responses: gin.Responses{201: nil, 404: nil, 500: nil},
+			})
 		}
 		s := e.Group("/artists")
 		{
-			s.GET("", artistsAPI.GetArtists)
-			s.GET("/:name", artistsAPI.GetArtistByName)
-			s.POST("/:name", artistsAPI.CreateArtist)
-			s.DELETE("/:name", artistsAPI.DeleteArtist)
+			s.GET("", artistsAPI.GetArtists, gin.Doc{
+				Summary:   "List every artist",
+				Responses: gin.Responses{200: api.Artists{}, 500: nil},
+			})
+			s.POST("", artistsAPI.CreateArtists, gin.Doc{
+				Summary:   "Create many artists at once, all of them or none",
+				Request:   api.Artists{},
+				Responses: gin.Responses{201: nil, 400: nil, 409: nil, 500: nil},
+			})
+			s.GET("/:name", artistsAPI.GetArtistByName, gin.Doc{
+				Summary:   "Get an artist by its name",
+				Responses: gin.Responses{200: api.Artist{}, 404: nil, 500: nil},
+			})
+			s.POST("/:name", artistsAPI.CreateArtist, gin.Doc{
+				Summary:   "Create an artist",
+				Request:   api.Artist{},
+				Responses: gin.Responses{201: nil, 400: nil, 409: nil, 500: nil},
+			})
+			s.DELETE("/:name", artistsAPI.DeleteArtist, gin.Doc{
+				Summary:   "Delete an artist by its name",
+				Responses: gin.Responses{201: nil, 404: nil, 409: nil, 500: nil},
+			})
 		}
 		// u := e.Group("/user")
 		// {
@@ -50,6 +170,8 @@ func main() {
 		// 	u.DELETE("/:id", usersAPI.DeleteUser)
 		// }
 	}
+	registerAdmin(e, db, reads, cfg.AdminToken, log)
+	e.ServeDocs("Music API", cfg.AppVersion)
 	err = e.Run()
 	if err != nil {
 		panic(err)
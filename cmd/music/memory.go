@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/pclavier92/go-restful-api/internal/artists"
+	"github.com/pclavier92/go-restful-api/internal/songs"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// inMemory returns the APIs keeping everything in memory, which is lost on restart
+func inMemory(log logs.Printer) (*songs.API, *artists.API) {
+	artistsRepo := artists.NewMemory(log)
+	songsRepo := songs.NewMemory(artistsRepo, log)
+	artistsRepo.SetInUse(songsRepo.UsesArtist)
+	_, songsAPI := songs.NewWithRepository(songsRepo, log)
+	_, artistsAPI := artists.NewWithRepository(artistsRepo, log)
+	return songsAPI, artistsAPI
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pclavier92/go-restful-api/migrations"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+)
+
+// migrate applies the pending migrations, see cmd/migrate for the rest
+func migrate(db *persist.Conn) error {
+	fsys, err := migrations.For(db.Dialect().Name())
+	if err != nil {
+		return err
+	}
+	m, err := persist.NewMigrator(db, fsys)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(context.Background())
+	return err
+}
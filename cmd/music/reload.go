@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/pkg/gin"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+)
+
+// watchConfig will apply the safe changes of the config while the API runs
+func watchConfig(cfg config.H, log logs.Printer, db *persist.Conn, cors *gin.CORS) {
+	w := config.Watch(cfg, os.Args[1:])
+	w.OnReject = func(fields []string) {
+		log.Warn("Config changes need a restart, ignoring them", logs.I{"fields": fields})
+	}
+	w.OnError = func(err error) {
+		log.Error("Could not reload config", logs.I{"error": err.Error()})
+	}
+	w.Subscribe(func(old, next config.H) {
+		if l, ok := log.(logs.Leveler); ok && old.LogLevel != next.LogLevel {
+			if err := l.SetLevel(next.LogLevel); err != nil {
+				log.Error("Could not change log level", logs.I{"error": err.Error()})
+			}
+		}
+		if db != nil {
+			db.SetPool(next.DBMaxOpenConns, next.DBMaxIdleConns)
+			db.SetConnLifetime(next.DBConnMaxLifetime, next.DBConnMaxIdleTime)
+			db.SetSlowQuery(next.DBSlowQueryThreshold)
+		}
+		cors.SetOrigins(next.CORSOrigins)
+		if r, err := logs.NewRedactor(next.RedactFields, next.RedactPatterns); err != nil {
+			log.Error("Could not change redacted fields", logs.I{"error": err.Error()})
+		} else {
+			logs.SetRedactor(r)
+		}
+		log.Info("Config reloaded", logs.I{"config": next.Dump()})
+	})
+	go w.Run(5*time.Second, nil)
+}
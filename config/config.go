@@ -3,65 +3,186 @@ package config
 import (
 	"os"
 	"strings"
+	"time"
 )
 
-// H is a simple holder for configuration
+// H is a simple holder for configuration.
+//
+// Every field can be set, in order of precedence, by a command line flag,
+// an env var or the config file, on top of the defaults of the scope.
+// The tags say how: yaml is the key in the file, env the env var and flag
+// the command line flag. Fields tagged secret can also be read from the file
+// named by the env var with a _FILE suffix, like Docker and K8s secrets. They
+// are masked when dumping the config, and required in production unless
+// tagged required:"false". Fields tagged required must be set,
+// unless they are tagged db and the database doesn't need them: db:"server"
+// fields are only needed by MySQL and PostgreSQL, db:"any" fields by every
+// database but the in memory one.
+// Fields tagged reload are safe to change while running, see Watcher.
 type H struct {
-	Productive bool
-	Job        bool
-	Port       string
-	Scope      string
-	AppVersion string
-	DBUser     string
-	DBPass     string
-	DBHost     string
-	DBName     string
+	Productive bool   `yaml:"-"`
+	Job        bool   `yaml:"-"`
+	Scope      string `yaml:"-"`
+	// File is the config file this config was read from, if any
+	File       string `yaml:"-"`
+	AppVersion string `yaml:"version" env:"VERSION" flag:"version"`
+	Port       string `yaml:"port" env:"PORT" flag:"port" required:"true"`
+	DBUser     string `yaml:"dbUser" env:"DB_USER" flag:"db-user" required:"true" db:"server"`
+	DBPass     string `yaml:"dbPass" env:"DB_PASS" flag:"db-pass" secret:"true" db:"server"`
+	DBHost     string `yaml:"dbHost" env:"DB_HOST" flag:"db-host" required:"true" db:"server"`
+	DBName     string `yaml:"dbName" env:"DB_NAME" flag:"db-name" required:"true" db:"any"`
+	// DBDriver is the database we talk to: mysql, postgres, sqlite, for which DBName is the file,
+	// or memory to keep everything in memory, for demos
+	DBDriver string `yaml:"dbDriver" env:"DB_DRIVER" flag:"db-driver"`
+	// DBMaxOpenConns is the maximum number of connections open to the database
+	DBMaxOpenConns int `yaml:"dbMaxOpenConns" env:"DB_MAX_OPEN_CONNS" flag:"db-max-open-conns" reload:"true"`
+	// DBMaxIdleConns is the maximum number of idle connections kept in the pool
+	DBMaxIdleConns int `yaml:"dbMaxIdleConns" env:"DB_MAX_IDLE_CONNS" flag:"db-max-idle-conns" reload:"true"`
+	// TraceOutput is where spans are exported: "stdout", "file:<path>" or empty for none
+	TraceOutput string `yaml:"traceOutput" env:"TRACE_OUTPUT" flag:"trace-output"`
+	// LogLevel is one of debug, info, warn or error
+	LogLevel string `yaml:"logLevel" env:"LOG_LEVEL" flag:"log-level" required:"true" reload:"true"`
+	// LogFormat is either text or json
+	LogFormat string `yaml:"logFormat" env:"LOG_FORMAT" flag:"log-format"`
+	// LogOutput is either stdout or file
+	LogOutput string `yaml:"logOutput" env:"LOG_OUTPUT" flag:"log-output"`
+	// LogFile is where logs are written when LogOutput is file
+	LogFile string `yaml:"logFile" env:"LOG_FILE" flag:"log-file"`
+	// LogMaxSizeMB is the size at which LogFile is rotated, 0 for never
+	LogMaxSizeMB int `yaml:"logMaxSizeMB" env:"LOG_MAX_SIZE_MB" flag:"log-max-size-mb"`
+	// LogMaxBackups is how many rotated log files are kept
+	LogMaxBackups int `yaml:"logMaxBackups" env:"LOG_MAX_BACKUPS" flag:"log-max-backups"`
+	// AccessLogSampleRate is the fraction (0 to 1) of successful requests printed in the access log
+	AccessLogSampleRate float64 `yaml:"accessLogSampleRate" env:"ACCESS_LOG_SAMPLE_RATE" flag:"access-log-sample-rate"`
+	// LogBodies will print the body of every request at debug level
+	LogBodies bool `yaml:"logBodies" env:"LOG_BODIES" flag:"log-bodies"`
+	// RedactFields are masked in logs and errors, on top of the usual password, token...
+	RedactFields []string `yaml:"redactFields" env:"REDACT_FIELDS" flag:"redact-fields" reload:"true"`
+	// RedactPatterns are regular expressions of values masked in logs and errors
+	RedactPatterns []string `yaml:"redactPatterns" env:"REDACT_PATTERNS" flag:"redact-patterns" reload:"true"`
+	// CORSOrigins are the origins allowed to call the API from a browser, * for any
+	CORSOrigins []string `yaml:"corsOrigins" env:"CORS_ORIGINS" flag:"cors-origins" reload:"true"`
+	// JobName is the job run in job mode, by default what follows "job" in the scope, like SCOPE=job-catalog-stats
+	JobName string `yaml:"jobName" env:"JOB_NAME" flag:"job"`
+	// RunJobs runs the scheduled jobs inside the API
+	RunJobs bool `yaml:"runJobs" env:"RUN_JOBS" flag:"run-jobs"`
+	// AutoMigrate applies the pending migrations when the API starts
+	AutoMigrate bool `yaml:"autoMigrate" env:"AUTO_MIGRATE" flag:"auto-migrate"`
+	// DBStmtCacheSize is how many prepared statements are kept for the queries run most often, 0 for none
+	DBStmtCacheSize int `yaml:"dbStmtCacheSize" env:"DB_STMT_CACHE_SIZE" flag:"db-stmt-cache-size"`
+	// DBReplicas are the hosts of the read replicas, with the same user, password and database as DBHost
+	DBReplicas []string `yaml:"dbReplicas" env:"DB_REPLICAS" flag:"db-replicas"`
+	// DBConnMaxLifetime is how long a connection is used before being closed, 0 for ever
+	DBConnMaxLifetime time.Duration `yaml:"dbConnMaxLifetime" env:"DB_CONN_MAX_LIFETIME" flag:"db-conn-max-lifetime" reload:"true"`
+	// DBConnMaxIdleTime is how long a connection is kept idle before being closed, 0 for ever
+	DBConnMaxIdleTime time.Duration `yaml:"dbConnMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME" flag:"db-conn-max-idle-time" reload:"true"`
+	// DBDialTimeout is how long connecting to the database may take
+	DBDialTimeout time.Duration `yaml:"dbDialTimeout" env:"DB_DIAL_TIMEOUT" flag:"db-dial-timeout"`
+	// DBReadTimeout and DBWriteTimeout limit each read and write on a MySQL connection, 0 for no limit.
+	// There is no read limit by default: waiting for the lock of the migrations, or for a long
+	// ALTER TABLE, is a single read, and the requests are limited by their context anyway.
+	DBReadTimeout  time.Duration `yaml:"dbReadTimeout" env:"DB_READ_TIMEOUT" flag:"db-read-timeout"`
+	DBWriteTimeout time.Duration `yaml:"dbWriteTimeout" env:"DB_WRITE_TIMEOUT" flag:"db-write-timeout"`
+	// DBTLS is how to use TLS with the database: empty for not at all, true, skip-verify or preferred
+	DBTLS string `yaml:"dbTLS" env:"DB_TLS" flag:"db-tls"`
+	// DBTLSCA is a PEM file with the certificate authority of the database, to verify it with when DBTLS is true
+	DBTLSCA string `yaml:"dbTLSCA" env:"DB_TLS_CA" flag:"db-tls-ca"`
+	// DBCharset and DBCollation are the ones of the MySQL connections, utf8mb4 so songs can have emojis
+	DBCharset   string `yaml:"dbCharset" env:"DB_CHARSET" flag:"db-charset"`
+	DBCollation string `yaml:"dbCollation" env:"DB_COLLATION" flag:"db-collation"`
+	// DBConnectRetries is how many times connecting to the database is retried when the API starts
+	DBConnectRetries int `yaml:"dbConnectRetries" env:"DB_CONNECT_RETRIES" flag:"db-connect-retries"`
+	// DBConnectBackoff is the wait before the first retry, doubled on every other one
+	DBConnectBackoff time.Duration `yaml:"dbConnectBackoff" env:"DB_CONNECT_BACKOFF" flag:"db-connect-backoff"`
+	// DBSlowQueryThreshold is how long a query takes to be logged as slow, 0 logs none
+	DBSlowQueryThreshold time.Duration `yaml:"dbSlowQueryThreshold" env:"DB_SLOW_QUERY_THRESHOLD" flag:"db-slow-query-threshold" reload:"true"`
+	// CacheSize is how many catalog reads are kept in memory, 0 for none
+	CacheSize int `yaml:"cacheSize" env:"CACHE_SIZE" flag:"cache-size"`
+	// CacheTTL is how long a catalog read is kept, in case a write is not seen
+	CacheTTL time.Duration `yaml:"cacheTTL" env:"CACHE_TTL" flag:"cache-ttl"`
+	// CacheMaxAge is how long clients and proxies may keep the catalog reads
+	CacheMaxAge time.Duration `yaml:"cacheMaxAge" env:"CACHE_MAX_AGE" flag:"cache-max-age"`
+	// CachePrimary fills the cache from the primary, not from a replica which may be behind the writes
+	CachePrimary bool `yaml:"cachePrimary" env:"CACHE_PRIMARY" flag:"cache-primary"`
+	// AdminToken is the bearer token of the /admin endpoints, which are not served without one
+	AdminToken string `yaml:"adminToken" env:"ADMIN_TOKEN" flag:"admin-token" secret:"true" required:"false"`
 }
 
-// New will return a simple holder for our app-wide configuration
-func New() H {
-	scope, ver := os.Getenv("SCOPE"), os.Getenv("VERSION")
-	job := false
+// defaults returns the config for a scope before reading files, env vars or flags.
+// There are no credentials for production here, they must come from outside.
+func defaults(scope string) H {
+	job, jobName := false, ""
 	if strings.HasPrefix(scope, "job") {
+		jobName = strings.Trim(strings.TrimPrefix(scope, "job"), "-_:")
 		scope = "production"
 		job = true
 	}
+	h := H{
+		Job:                  job,
+		DBDriver:             "mysql",
+		JobName:              jobName,
+		RunJobs:              true,
+		LogOutput:            "stdout",
+		LogFile:              "music.log",
+		LogMaxSizeMB:         100,
+		LogMaxBackups:        3,
+		AccessLogSampleRate:  1,
+		DBMaxOpenConns:       5,
+		DBMaxIdleConns:       5,
+		DBStmtCacheSize:      100,
+		DBConnMaxLifetime:    30 * time.Minute,
+		DBConnMaxIdleTime:    5 * time.Minute,
+		DBDialTimeout:        5 * time.Second,
+		DBWriteTimeout:       30 * time.Second,
+		DBCharset:            "utf8mb4",
+		DBCollation:          "utf8mb4_unicode_ci",
+		DBConnectRetries:     5,
+		DBConnectBackoff:     time.Second,
+		DBSlowQueryThreshold: 200 * time.Millisecond,
+		CacheSize:            1000,
+		CacheTTL:             time.Minute,
+		CacheMaxAge:          10 * time.Second,
+	}
 	switch scope {
 	case "production":
-		return H{
-			true,
-			job,
-			"8080",
-			"production",
-			ver,
-			"niceDbUser",
-			"niceDBPass",
-			"niceDBHost",
-			"niceDBName",
-		}
+		h.Productive = true
+		h.Port = "8080"
+		h.Scope = "production"
+		h.LogLevel = "info"
+		h.LogFormat = "json"
+		h.AccessLogSampleRate = 0.1
 	case "test":
-		return H{
-			false,
-			job,
-			"8080",
-			"test",
-			ver,
-			"testDbUser",
-			"testDBPass",
-			"testDBHost",
-			"testDBName",
-		}
+		h.Port = "8080"
+		h.Scope = "test"
+		h.RunJobs = false
+		h.LogLevel = "debug"
+		h.LogFormat = "text"
 	default:
-		return H{
-			false,
-			job,
-			"3000",
-			"local",
-			"local",
-			"root",
-			"root",
-			"127.0.0.1:3306",
-			"Music",
-		}
+		h.Port = "3000"
+		h.Scope = "local"
+		h.AppVersion = "local"
+		h.AutoMigrate = true
+		h.DBUser = "root"
+		h.DBPass = "root"
+		h.DBHost = "127.0.0.1:3306"
+		h.DBName = "Music"
+		h.LogLevel = "debug"
+		h.LogFormat = "text"
+	}
+	return h
+}
+
+// New will return a simple holder for our app-wide configuration, read
+// from the defaults of SCOPE, the file in CONFIG_FILE and the env vars.
+// It panics if the config is invalid, use Load to handle the error.
+func New() H {
+	h, err := Load(nil)
+	if err != nil {
+		panic(err)
 	}
+	return h
+}
+
+func scope() string {
+	return os.Getenv("SCOPE")
 }
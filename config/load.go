@@ -0,0 +1,252 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileEnv is the env var with the path of the config file
+const FileEnv = "CONFIG_FILE"
+
+// Load returns the configuration for the SCOPE env var, layering in order:
+// its defaults, the YAML config file (-config flag or CONFIG_FILE env var),
+// env vars and finally the command line flags in args. Secrets may be read
+// from files and the result is validated. It returns flag.ErrHelp when args
+// ask for the usage, which is already printed.
+func Load(args []string) (H, error) {
+	h := defaults(scope())
+	fs, path := flags()
+	if err := fs.Parse(args); err != nil {
+		return h, err
+	}
+	if *path == "" {
+		*path = os.Getenv(FileEnv)
+	}
+	if *path != "" {
+		if err := h.readFile(*path); err != nil {
+			return h, err
+		}
+		h.File = *path
+	}
+	if err := h.readEnv(); err != nil {
+		return h, err
+	}
+	if err := h.readFlags(fs); err != nil {
+		return h, err
+	}
+	return h, h.Validate()
+}
+
+// fields calls fn with every configurable field of h
+func (h *H) fields(fn func(f reflect.StructField, v reflect.Value) error) error {
+	v := reflect.ValueOf(h).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("yaml") == "-" {
+			continue
+		}
+		if err := fn(f, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *H) readFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(b, h); err != nil {
+		return fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func (h *H) readEnv() error {
+	return h.fields(func(f reflect.StructField, v reflect.Value) error {
+		env := f.Tag.Get("env")
+		if env == "" {
+			return nil
+		}
+		if s, ok := os.LookupEnv(env); ok {
+			if err := set(v, s); err != nil {
+				return fmt.Errorf("env var %s: %v", env, err)
+			}
+		}
+		if f.Tag.Get("secret") != "true" {
+			return nil
+		}
+		// secrets mounted as files, like /run/secrets/db_pass
+		if path, ok := os.LookupEnv(env + "_FILE"); ok {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("reading secret %s_FILE: %v", env, err)
+			}
+			v.SetString(strings.TrimSpace(string(b)))
+		}
+		return nil
+	})
+}
+
+// flags returns a flag set with a flag for each field and the -config flag.
+// The flags have the kind of their field, so booleans can be given bare,
+// like -log-bodies, and numbers and durations are checked while parsing.
+func flags() (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("music", flag.ContinueOnError)
+	path := fs.String("config", "", "path of the YAML config file")
+	var h H
+	_ = h.fields(func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("flag")
+		if name == "" {
+			return nil
+		}
+		usage := fmt.Sprintf("overrides %s (env %s)", f.Tag.Get("yaml"), f.Tag.Get("env"))
+		switch {
+		case v.Type() == durationType:
+			fs.Duration(name, 0, usage)
+		case v.Kind() == reflect.Bool:
+			fs.Bool(name, false, usage)
+		case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+			fs.Int64(name, 0, usage)
+		case v.Kind() == reflect.Float64:
+			fs.Float64(name, 0, usage)
+		default:
+			fs.String(name, "", usage)
+		}
+		return nil
+	})
+	return fs, path
+}
+
+func (h *H) readFlags(fs *flag.FlagSet) error {
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = f.Value.String() })
+	return h.fields(func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("flag")
+		if s, ok := given[name]; ok && name != "" {
+			if err := set(v, s); err != nil {
+				return fmt.Errorf("flag -%s: %v", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses s into the field v
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var l []string
+		for _, e := range strings.Split(s, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				l = append(l, e)
+			}
+		}
+		v.Set(reflect.ValueOf(l))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// ValidationError lists every required field which is missing
+type ValidationError struct {
+	Missing []string
+}
+
+func (e *ValidationError) Error() string {
+	return "missing required config: " + strings.Join(e.Missing, ", ")
+}
+
+// Validate makes sure every required field is set. In production the
+// secrets are required too, so we never run with an empty password, and
+// in job mode we need to know which job to run.
+func (h H) Validate() error {
+	var missing []string
+	_ = h.fields(func(f reflect.StructField, v reflect.Value) error {
+		switch f.Tag.Get("db") {
+		case "server":
+			if h.DBDriver == "sqlite" || h.DBDriver == "memory" {
+				return nil
+			}
+		case "any":
+			if h.DBDriver == "memory" {
+				return nil
+			}
+		}
+		required := f.Tag.Get("required") == "true" || (h.Productive && f.Tag.Get("secret") == "true" && f.Tag.Get("required") != "false")
+		if required && isZero(v) {
+			missing = append(missing, fmt.Sprintf("%s (env %s)", f.Tag.Get("yaml"), f.Tag.Get("env")))
+		}
+		return nil
+	})
+	if h.Job && h.JobName == "" {
+		missing = append(missing, "jobName (env JOB_NAME)")
+	}
+	if len(missing) > 0 {
+		return &ValidationError{missing}
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// Mask replaces the value of secrets when dumping the config
+const Mask = "[REDACTED]"
+
+// Dump returns the effective config keyed as in the config file, with every
+// secret masked, so it can be logged at boot.
+func (h H) Dump() map[string]interface{} {
+	d := map[string]interface{}{"scope": h.Scope, "job": h.Job}
+	_ = h.fields(func(f reflect.StructField, v reflect.Value) error {
+		val := v.Interface()
+		if f.Tag.Get("secret") == "true" && !isZero(v) {
+			val = Mask
+		}
+		d[f.Tag.Get("yaml")] = val
+		return nil
+	})
+	return d
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "music.yaml")
+	secret := filepath.Join(dir, "db_pass")
+	yaml := "port: \"9000\"\ndbUser: fileUser\ndbHost: fileHost\ndbName: fileName\nlogLevel: warn\n"
+	if err := ioutil.WriteFile(file, []byte(yaml), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env := map[string]string{
+		"SCOPE":        "production",
+		"DB_USER":      "envUser",
+		"DB_PASS_FILE": secret,
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	h, err := Load([]string{"-config", file, "-db-host", "flagHost", "-redact-fields", "ssn, pin", "-log-bodies", "-db-max-open-conns", "7", "-cache-ttl", "2m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !h.Productive || h.LogFormat != "json" {
+		t.Errorf("expected production defaults, got: %+v", h)
+	}
+	if h.Port != "9000" || h.DBName != "fileName" || h.LogLevel != "warn" {
+		t.Errorf("expected values from the file, got: %+v", h)
+	}
+	if h.DBUser != "envUser" || h.DBPass != "s3cret" {
+		t.Errorf("expected env vars to override the file, got: %+v", h)
+	}
+	if h.DBHost != "flagHost" || len(h.RedactFields) != 2 || h.RedactFields[1] != "pin" {
+		t.Errorf("expected flags to override everything, got: %+v", h)
+	}
+	if !h.LogBodies || h.DBMaxOpenConns != 7 || h.CacheTTL != 2*time.Minute {
+		t.Errorf("expected flags of every kind, got: %+v", h)
+	}
+	if _, err := Load([]string{"-h"}); err != flag.ErrHelp {
+		t.Errorf("expected flag.ErrHelp, got: %v", err)
+	}
+	if d := h.Dump(); d["dbPass"] != Mask || d["dbUser"] != "envUser" {
+		t.Errorf("expected secrets to be masked in the dump, got: %v", d)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	os.Setenv("SCOPE", "production")
+	defer os.Unsetenv("SCOPE")
+	_, err := Load(nil)
+	v, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got: %v", err)
+	}
+	if len(v.Missing) != 4 {
+		t.Errorf("expected db user, pass, host and name to be missing, got: %v", v.Missing)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	old := defaults("local")
+	next := old
+	next.LogLevel = "warn"
+	next.CORSOrigins = []string{"https://music.example"}
+	next.Port = "9000"
+	applied, rejected := merge(old, next)
+	if applied.LogLevel != "warn" || len(applied.CORSOrigins) != 1 {
+		t.Errorf("expected safe changes to be applied, got: %+v", applied)
+	}
+	if applied.Port != old.Port || len(rejected) != 1 || rejected[0] != "port" {
+		t.Errorf("expected the port change to be rejected, got: %s, %v", applied.Port, rejected)
+	}
+}
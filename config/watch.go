@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads the config when its file changes or the process gets a
+// SIGHUP. Only fields tagged reload are applied live; changes to any other
+// field are rejected, and reported, until the next restart.
+type Watcher struct {
+	mu      sync.Mutex
+	args    []string
+	current H
+	modTime time.Time
+	subs    []func(old, next H)
+	// OnReject is called with the fields which changed but need a restart
+	OnReject func(fields []string)
+	// OnError is called when the new config could not be loaded
+	OnError func(err error)
+}
+
+// Watch returns a Watcher for the config h, which was loaded with args
+func Watch(h H, args []string) *Watcher {
+	w := &Watcher{args: args, current: h, OnReject: func([]string) {}, OnError: func(error) {}}
+	w.modTime = w.fileModTime()
+	return w
+}
+
+// Current returns the config in use
+func (w *Watcher) Current() H {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called with the old and new config every time
+// a reload changes something. Only the safe fields differ between them.
+func (w *Watcher) Subscribe(fn func(old, next H)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Run checks the config file every interval and listens for SIGHUP,
+// reloading the config until stop is closed.
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			w.reload()
+		case <-ticker.C:
+			if t := w.fileModTime(); !t.Equal(w.modTime) {
+				w.modTime = t
+				w.reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	if err := w.Reload(); err != nil {
+		w.OnError(err)
+	}
+}
+
+// Reload loads the config again and applies its safe changes
+func (w *Watcher) Reload() error {
+	next, err := Load(w.args)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	old := w.current
+	applied, rejected := merge(old, next)
+	w.current = applied
+	subs := append([]func(old, next H){}, w.subs...)
+	w.mu.Unlock()
+	if len(rejected) > 0 {
+		w.OnReject(rejected)
+	}
+	if reflect.DeepEqual(old, applied) {
+		return nil
+	}
+	for _, fn := range subs {
+		fn(old, applied)
+	}
+	return nil
+}
+
+// merge returns old with the safe changes of next, and the names of the
+// fields which changed but are not safe to change live
+func merge(old, next H) (H, []string) {
+	applied := old
+	var rejected []string
+	o := reflect.ValueOf(old)
+	n := reflect.ValueOf(next)
+	a := reflect.ValueOf(&applied).Elem()
+	t := o.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("yaml") == "-" || reflect.DeepEqual(o.Field(i).Interface(), n.Field(i).Interface()) {
+			continue
+		}
+		if f.Tag.Get("reload") != "true" {
+			rejected = append(rejected, f.Tag.Get("yaml"))
+			continue
+		}
+		a.Field(i).Set(n.Field(i))
+	}
+	return applied, rejected
+}
+
+func (w *Watcher) fileModTime() time.Time {
+	if w.current.File == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(w.current.File)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
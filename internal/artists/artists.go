@@ -1,57 +1,106 @@
 package artists
 
 import (
+	"context"
+
 	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/pkg/cache"
 	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/flight"
 	"github.com/pclavier92/go-restful-api/pkg/gin"
 	"github.com/pclavier92/go-restful-api/pkg/logs"
 	"github.com/pclavier92/go-restful-api/pkg/persist"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
 )
 
-type persistor interface {
-	get(name string) (api.Artists, error)
-	create(s api.Artist) (bool, error)
-	delete(name string) (bool, error)
+// Repository is where the artists are stored. Create and CreateMany fail with
+// errors.Conflict when a name is taken, and Delete when the artist has songs.
+type Repository interface {
+	// Get returns every artist when name is empty, or the one called name
+	Get(ctx context.Context, name string) (api.Artists, error)
+	// Create saves a new artist
+	Create(ctx context.Context, s api.Artist) (bool, error)
+	// CreateMany saves every new artist, all of them or none
+	CreateMany(ctx context.Context, artists api.Artists) error
+	// Delete removes the artist called name, telling if there was one
+	Delete(ctx context.Context, name string) (bool, error)
 }
 
 type db struct {
-	persist.Querier
-	err errors.Structer
+	// Executor runs the queries, either on the connection or on a transaction
+	persist.Executor
+	conn persist.Querier
+	err  errors.Structer
 	logs.Printer
 }
 
-// Service works as a holder for dependencies of pentests
+// in returns the same db, running its queries in tx
+func (db db) in(tx *persist.Tx) db {
+	db.Executor = tx
+	return db
+}
+
+// Service works as a holder for dependencies of artists
 type Service struct {
-	db  persistor
-	err errors.Structer
-	log logs.Printer
+	repo Repository
+	err  errors.Structer
+	log  logs.Printer
+	// reads caches the reads until a write changes them, and runs the
+	// identical ones made at the same time only once
+	reads cache.Reads
 }
 
-// API has an HTTP interface for the pentests
+// API has an HTTP interface for the artists
 type API struct {
-	s   Service
+	s   *Service
 	err errors.Structer
 }
 
-// New will return a new Service for the pentests and an API to expose them via HTTP.
+// New will return a new Service for the artists and an API to expose them via HTTP.
 func New(sql persist.Querier, log logs.Printer) (*Service, *API) {
+	e := errors.Pkg("artists", log)
+	return NewWithRepository(db{sql, sql, e.Struct("db"), log}, log)
+}
+
+// NewWithRepository is like New, but keeps the artists in repo instead of the database
+func NewWithRepository(repo Repository, log logs.Printer) (*Service, *API) {
 	e := errors.Pkg("artists", log)
 	s := Service{
-		db:  db{sql, e.Struct("db"), log},
-		err: e.Struct("service"),
-		log: log}
-	return &s, &API{s, e.Struct("api")}
+		repo: repo,
+		err:  e.Struct("service"),
+		log:  log}
+	return &s, &API{&s, e.Struct("api")}
+}
+
+// UseCache keeps the artists read in store for the TTL of opts, forgetting
+// them as soon as they are written through s, and lets clients keep them
+// for its MaxAge. Call it before using s.
+func (s *Service) UseCache(store cache.Store, opts cache.Options) {
+	s.reads.Use(store, opts, s.log)
+}
+
+// Coalescing tells how many reads of the artists shared the query of another
+func (s *Service) Coalescing() flight.Stats {
+	return s.reads.Stats()
 }
 
+// cache keys, the store may be shared with other services, and the keys
+// of the reads being coalesced
+const (
+	allArtists    = "artists:all"
+	artistsByName = "artists:name:"
+)
+
 /*---------------   API   ---------------*/
 
 // GetArtists will retrieve the list of artists.
 func (a API) GetArtists(c *gin.Context) (int, interface{}, error) {
 	e := a.err.Fn("GetArtists")
-	artists, err := a.s.getArtists()
+	artists, err := a.s.getArtists(c.Ctx())
 	if err != nil {
-		return 500, artists, e.UK(err)
+		return errors.Status(err), artists, e.UK(err)
 	}
+	c.CacheFor(a.s.reads.MaxAge())
 	return 200, artists, nil
 }
 
@@ -59,12 +108,11 @@ func (a API) GetArtists(c *gin.Context) (int, interface{}, error) {
 func (a API) GetArtistByName(c *gin.Context) (int, interface{}, error) {
 	name := c.Param("name")
 	e := a.err.Fn("GetArtistByName").Tag("name", name)
-	artist, ok, err := a.s.getArtistByName(name)
+	artist, err := a.s.getArtistByName(c.Ctx(), name)
 	if err != nil {
-		return 500, nil, e.UK(err)
-	} else if !ok {
-		return 404, nil, e.NotFound()
+		return errors.Status(err), nil, e.UK(err)
 	}
+	c.CacheFor(a.s.reads.MaxAge())
 	return 200, artist, nil
 }
 
@@ -73,14 +121,25 @@ func (a API) CreateArtist(c *gin.Context) (int, interface{}, error) {
 	e := a.err.Fn("CreateArtist")
 	var artist api.Artist
 	if err := c.BindJSON(&artist); err != nil {
-		return 400, nil, e.JSON(err, "binding")
+		err = e.JSON(err, "binding")
+		return errors.Status(err), nil, err
 	}
-	invalid, err := a.s.saveArtist(artist)
-	if err != nil {
-		return 500, nil, e.UK(err)
+	if err := a.s.saveArtist(c.Ctx(), artist); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
-	if invalid {
-		return 400, nil, e.DB(err)
+	return 201, nil, nil
+}
+
+// CreateArtists will save many artists at once. Takes a JSON list of new artists.
+func (a API) CreateArtists(c *gin.Context) (int, interface{}, error) {
+	e := a.err.Fn("CreateArtists")
+	var artists api.Artists
+	if err := c.BindJSON(&artists); err != nil {
+		err = e.JSON(err, "binding")
+		return errors.Status(err), nil, err
+	}
+	if err := a.s.saveArtists(c.Ctx(), artists); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
 	return 201, nil, nil
 }
@@ -89,12 +148,8 @@ func (a API) CreateArtist(c *gin.Context) (int, interface{}, error) {
 func (a API) DeleteArtist(c *gin.Context) (int, interface{}, error) {
 	name := c.Param("name")
 	e := a.err.Fn("DeleteArtist").Tag("name", name)
-	invalid, err := a.s.deleteArtist(name)
-	if err != nil {
-		return 500, nil, e.UK(err)
-	}
-	if invalid {
-		return 400, nil, e.DB(err)
+	if err := a.s.deleteArtist(c.Ctx(), name); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
 	return 201, nil, nil
 }
@@ -102,99 +157,161 @@ func (a API) DeleteArtist(c *gin.Context) (int, interface{}, error) {
 /*--------------- SERVICES ---------------*/
 
 // getArtists will get all artists.
-func (s *Service) getArtists() (api.Artists, error) {
+func (s *Service) getArtists(ctx context.Context) (api.Artists, error) {
+	ctx, span := trace.Start(ctx, "artists.Service.getArtists")
+	defer span.End()
 	e := s.err.Fn("getArtists")
-	artists, err := s.db.get("")
+	var artists api.Artists
+	err := s.reads.Get(ctx, allArtists, &artists, func(ctx context.Context) (interface{}, bool, error) {
+		artists, err := s.repo.Get(ctx, "")
+		return artists, true, err
+	})
 	if err != nil {
 		return api.Artists{}, e.Wrap(err, "getting artists from db")
 	}
 	return artists, nil
 }
 
-// getArtistByName will get an artist by its name.
-func (s Service) getArtistByName(name string) (api.Artist, bool, error) {
+// getArtistByName will get an artist by its name. Fails with errors.NotFound if there is no such artist.
+func (s *Service) getArtistByName(ctx context.Context, name string) (api.Artist, error) {
+	ctx, span := trace.Start(ctx, "artists.Service.getArtistByName")
+	defer span.End()
 	e := s.err.Fn("getArtistByName").Tag("name", name)
-	artists, err := s.db.get(name)
+	var artists api.Artists
+	err := s.reads.Get(ctx, artistsByName+name, &artists, func(ctx context.Context) (interface{}, bool, error) {
+		artists, err := s.repo.Get(ctx, name)
+		return artists, len(artists) > 0, err
+	})
 	if err != nil {
-		return api.Artist{}, false, e.Wrap(err, "getting contract from db")
-	} else if len(artists) != 1 {
-		return api.Artist{}, false, nil
+		return api.Artist{}, e.Wrap(err, "getting artist from db")
+	}
+	if len(artists) != 1 {
+		return api.Artist{}, e.NotFound()
 	}
 	artist := artists[0]
-	return artist, true, nil
+	return artist, nil
 }
 
 // saveArtist will make sure an artist is saved in the db
-func (s *Service) saveArtist(i api.Artist) (invalid bool, err error) {
+func (s *Service) saveArtist(ctx context.Context, i api.Artist) error {
+	ctx, span := trace.Start(ctx, "artists.Service.saveArtist")
+	defer span.End()
 	e := s.err.Fn("saveArtist")
-	ok, err := s.db.create(i)
-	if err != nil {
-		return true, e.Wrap(err, "saving artist")
-	} else if !ok {
-		return true, nil
-	}
-	return false, nil
+	_, err := s.repo.Create(ctx, i)
+	s.forget(ctx, api.Artists{i})
+	return e.Wrap(err, "saving artist")
+}
+
+// saveArtists will make sure every artist is saved in the db, or none
+func (s *Service) saveArtists(ctx context.Context, artists api.Artists) error {
+	ctx, span := trace.Start(ctx, "artists.Service.saveArtists")
+	defer span.End()
+	e := s.err.Fn("saveArtists")
+	err := s.repo.CreateMany(ctx, artists)
+	s.forget(ctx, artists)
+	return e.Wrap(err, "saving artists")
 }
 
-// deleteArtist will make sure an artist is deleted from the db
-func (s *Service) deleteArtist(name string) (invalid bool, err error) {
+// deleteArtist will make sure an artist is deleted from the db. Fails with errors.NotFound if there is no such artist.
+func (s *Service) deleteArtist(ctx context.Context, name string) error {
+	ctx, span := trace.Start(ctx, "artists.Service.deleteArtist")
+	defer span.End()
 	e := s.err.Fn("deleteArtist")
-	ok, err := s.db.delete(name)
+	ok, err := s.repo.Delete(ctx, name)
+	s.forget(ctx, api.Artists{{Name: name}})
 	if err != nil {
-		return true, e.Wrap(err, "deleting artist")
+		return e.Wrap(err, "deleting artist")
 	} else if !ok {
-		return true, nil
+		return e.NotFound()
 	}
-	return false, nil
+	return nil
+}
+
+// forget takes the artists out of the cache, see cache.Reads.Forget
+func (s *Service) forget(ctx context.Context, artists api.Artists) {
+	keys := []string{allArtists}
+	for _, a := range artists {
+		keys = append(keys, artistsByName+a.Name)
+	}
+	s.reads.Forget(ctx, keys...)
 }
 
 /*---------------    DB    ---------------*/
 
-// get will return artists from db
-func (db db) get(name string) (api.Artists, error) {
-	e := db.err.Fn("get").Tag("name", name)
-	var err error
-	var rows *persist.Rows
-	query := `SELECT id, name FROM Artists `
+// Get will return artists from db
+func (db db) Get(ctx context.Context, name string) (api.Artists, error) {
+	e := db.err.Fn("Get").Tag("name", name)
+	q := persist.Select("id", "name").From("Artists")
 	if name != "" {
-		query = query + "WHERE name = ? LIMIT 1"
-		rows, err = db.Query(query, name)
-	} else {
-		rows, err = db.Query(query)
+		q = q.Where(persist.Eq("name", name)).Limit(1)
 	}
+	query, args := q.Build(db.Dialect())
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, e.Wrap(err, "quering artists from table")
 	}
 	artists := api.Artists{}
-	for rows.Next() {
-		s := &api.Artist{}
-		err := rows.Scan(&(s.Id), &(s.Name))
-		if err != nil {
-			return nil, e.Wrap(err, "scanning rows")
-		}
-		artists = append(artists, *s)
+	if err := rows.ScanAll(&artists); err != nil {
+		return nil, e.Wrap(err, "scanning rows")
 	}
 	return artists, nil
 }
 
-// create will create a new artist in the db
-func (db db) create(s api.Artist) (bool, error) {
-	e := db.err.Fn("create")
-	query := `INSERT INTO Artists (name) VALUES (?)`
-	_, err := db.Exec(query, s.Name)
-	if err != nil {
+// Create will create a new artist in the db
+func (db db) Create(ctx context.Context, s api.Artist) (bool, error) {
+	e := db.err.Fn("Create").Tag("name", s.Name)
+	if err := db.insert(ctx, persist.Insert("Artists").Columns("name").Values(s.Name)); err != nil {
 		return false, e.Wrap(err, "inserting")
 	}
 	return true, nil
 }
 
-// delete will delete an existing artist from the db
-func (db db) delete(name string) (bool, error) {
-	e := db.err.Fn("delete")
-	query := `DELETE FROM Artists WHERE name = ?`
-	_, err := db.Exec(query, name)
-	if err != nil {
+// CreateMany will create every artist in the db, in as few inserts as it
+// can, in a transaction when it needs more than one
+func (db db) CreateMany(ctx context.Context, artists api.Artists) error {
+	e := db.err.Fn("CreateMany").Tag("artists", len(artists))
+	if len(artists) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, len(artists))
+	for i, a := range artists {
+		rows[i] = []interface{}{a.Name}
+	}
+	q := persist.Insert("Artists").Columns("name").Rows(rows...)
+	if q.Statements() == 1 {
+		return e.Wrap(db.insert(ctx, q), "inserting")
+	}
+	err := db.conn.WithTx(ctx, func(tx *persist.Tx) error {
+		return db.in(tx).insert(ctx, q)
+	})
+	return e.Wrap(err, "inserting")
+}
+
+// insert runs the insert q of artists
+func (db db) insert(ctx context.Context, q persist.InsertQuery) error {
+	e := db.err.Fn("insert")
+	_, err := persist.ExecInsert(ctx, db, q)
+	if persist.IsDuplicate(err) {
+		return e.Conflict(err, "inserting")
+	} else if err != nil {
+		return e.Wrap(err, "inserting")
+	}
+	return nil
+}
+
+// Delete will delete an existing artist from the db
+func (db db) Delete(ctx context.Context, name string) (bool, error) {
+	e := db.err.Fn("Delete")
+	query, args := persist.Delete("Artists").Where(persist.Eq("name", name)).Build(db.Dialect())
+	r, err := db.ExecContext(ctx, query, args...)
+	if persist.IsForeignKey(err) {
+		return false, e.Conflict(err, "deleting artist with songs")
+	} else if err != nil {
 		return false, e.Wrap(err, "deleting")
 	}
-	return true, nil
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, e.Wrap(err, "counting deleted rows")
+	}
+	return n > 0, nil
 }
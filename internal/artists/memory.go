@@ -0,0 +1,115 @@
+package artists
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// Memory keeps the artists in memory, for demos and tests.
+// It is safe to use from many goroutines.
+type Memory struct {
+	mu      sync.RWMutex
+	artists map[string]api.Artist
+	lastID  int
+	inUse   func(id int) bool
+	err     errors.Structer
+}
+
+// NewMemory returns an empty in memory repository
+func NewMemory(log logs.Printer) *Memory {
+	return &Memory{
+		artists: map[string]api.Artist{},
+		inUse:   func(int) bool { return false },
+		err:     errors.Pkg("artists", log).Struct("Memory"),
+	}
+}
+
+// SetInUse tells the repository how to know if an artist has songs,
+// which keeps it from being deleted, like a foreign key would.
+func (m *Memory) SetInUse(fn func(id int) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inUse = fn
+}
+
+// View runs fn with exists telling if there is an artist with an id, and
+// no artist is created or deleted until fn returns. fn must not call m.
+func (m *Memory) View(fn func(exists func(id int) bool) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(m.exists)
+}
+
+func (m *Memory) exists(id int) bool {
+	for _, a := range m.artists {
+		if a.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns every artist, sorted by id, or the one called name
+func (m *Memory) Get(ctx context.Context, name string) (api.Artists, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	artists := api.Artists{}
+	if name != "" {
+		if a, ok := m.artists[name]; ok {
+			artists = append(artists, a)
+		}
+		return artists, nil
+	}
+	for _, a := range m.artists {
+		artists = append(artists, a)
+	}
+	sort.Slice(artists, func(i, j int) bool { return artists[i].Id < artists[j].Id })
+	return artists, nil
+}
+
+// Create saves a new artist with the next id
+func (m *Memory) Create(ctx context.Context, a api.Artist) (bool, error) {
+	if err := m.CreateMany(ctx, api.Artists{a}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateMany saves every new artist like Create, none of them if any name is taken
+func (m *Memory) CreateMany(ctx context.Context, artists api.Artists) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := map[string]bool{}
+	for _, a := range artists {
+		if _, ok := m.artists[a.Name]; ok || names[a.Name] {
+			return m.err.Fn("CreateMany").Tag("name", a.Name).Conflict(errors.New("duplicate name"), "inserting")
+		}
+		names[a.Name] = true
+	}
+	for _, a := range artists {
+		m.lastID++
+		a.Id = m.lastID
+		m.artists[a.Name] = a
+	}
+	return nil
+}
+
+// Delete removes the artist called name, unless it has songs
+func (m *Memory) Delete(ctx context.Context, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.artists[name]
+	if !ok {
+		return false, nil
+	}
+	if m.inUse(a.Id) {
+		return false, m.err.Fn("Delete").Tag("name", name).Conflict(errors.New("artist has songs"), "deleting artist with songs")
+	}
+	delete(m.artists, name)
+	return true, nil
+}
@@ -0,0 +1,50 @@
+package artists
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(logstest.New())
+	s, _ := NewWithRepository(m, logstest.New())
+
+	if err := s.saveArtists(ctx, api.Artists{{Name: "B"}, {Name: "A"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.saveArtists(ctx, api.Artists{{Name: "C"}, {Name: "A"}}); !errors.Is(err, errors.Conflict) {
+		t.Errorf("expected a taken name to be a conflict, got: %v", err)
+	}
+	if err := s.saveArtist(ctx, api.Artist{Name: "B"}); !errors.Is(err, errors.Conflict) {
+		t.Errorf("expected a taken name to be a conflict, got: %v", err)
+	}
+	artists, err := s.getArtists(ctx)
+	if err != nil || len(artists) != 2 || artists[0].Name != "B" || artists[1].Id != 2 {
+		t.Errorf("expected only the first artists, by id, got %+v: %v", artists, err)
+	}
+	m.View(func(exists func(int) bool) error {
+		if !exists(2) || exists(3) {
+			t.Errorf("expected only the artists 1 and 2 to exist")
+		}
+		return nil
+	})
+
+	m.SetInUse(func(id int) bool { return id == 1 })
+	if err := s.deleteArtist(ctx, "B"); !errors.Is(err, errors.Conflict) {
+		t.Errorf("expected artists with songs not to be deleted, got: %v", err)
+	}
+	if err := s.deleteArtist(ctx, "A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.getArtistByName(ctx, "A"); !errors.Is(err, errors.NotFound) {
+		t.Errorf("expected the artist to be gone, got: %v", err)
+	}
+	if err := s.deleteArtist(ctx, "A"); !errors.Is(err, errors.NotFound) {
+		t.Errorf("expected the artist to be gone, got: %v", err)
+	}
+}
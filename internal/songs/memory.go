@@ -0,0 +1,108 @@
+package songs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// Artists tells the songs which artists exist
+type Artists interface {
+	// View runs fn with exists telling if there is an artist with an id,
+	// keeping every artist from being deleted until fn returns
+	View(fn func(exists func(id int) bool) error) error
+}
+
+// Memory keeps the songs in memory, for demos and tests.
+// It is safe to use from many goroutines.
+type Memory struct {
+	mu      sync.RWMutex
+	songs   map[string]api.Song
+	lastID  int
+	artists Artists
+	err     errors.Structer
+}
+
+// NewMemory returns an empty in memory repository, whose songs must be
+// of one of the artists
+func NewMemory(artists Artists, log logs.Printer) *Memory {
+	return &Memory{
+		songs:   map[string]api.Song{},
+		artists: artists,
+		err:     errors.Pkg("songs", log).Struct("Memory"),
+	}
+}
+
+// UsesArtist tells if any song is of the artist with the id
+func (m *Memory) UsesArtist(id int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.songs {
+		if s.ArtistId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns every song, sorted by id, or the one called name
+func (m *Memory) Get(ctx context.Context, name string) (api.Songs, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	songs := api.Songs{}
+	if name != "" {
+		if s, ok := m.songs[name]; ok {
+			songs = append(songs, s)
+		}
+		return songs, nil
+	}
+	for _, s := range m.songs {
+		songs = append(songs, s)
+	}
+	sort.Slice(songs, func(i, j int) bool { return songs[i].Id < songs[j].Id })
+	return songs, nil
+}
+
+// Save creates the song with the next id, or updates the duration and
+// artist of the one with the same name
+func (m *Memory) Save(ctx context.Context, s api.Song) error {
+	return m.SaveMany(ctx, api.Songs{s})
+}
+
+// SaveMany saves every song like Save, none of them if any is invalid
+func (m *Memory) SaveMany(ctx context.Context, songs api.Songs) error {
+	// the artists are locked before the songs, like when deleting one of
+	// them asks us if it has songs, so none goes away while we save
+	return m.artists.View(func(exists func(id int) bool) error {
+		for _, s := range songs {
+			if !exists(s.ArtistId) {
+				return m.err.Fn("SaveMany").Tag("name", s.Name).InvalidFields("saving", noArtist)
+			}
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, s := range songs {
+			if old, ok := m.songs[s.Name]; ok {
+				s.Id = old.Id
+			} else {
+				m.lastID++
+				s.Id = m.lastID
+			}
+			m.songs[s.Name] = s
+		}
+		return nil
+	})
+}
+
+// Delete removes the song called name
+func (m *Memory) Delete(ctx context.Context, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.songs[name]
+	delete(m.songs, name)
+	return ok, nil
+}
@@ -0,0 +1,115 @@
+package songs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/internal/artists"
+	"github.com/pclavier92/go-restful-api/pkg/cache"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	log := logstest.New()
+	artistsRepo := artists.NewMemory(log)
+	songsRepo := NewMemory(artistsRepo, log)
+	artistsRepo.SetInUse(songsRepo.UsesArtist)
+	s, _ := NewWithRepository(songsRepo, log)
+
+	if err := s.saveSong(ctx, api.Song{Name: "Song", ArtistId: 1}); !errors.Is(err, errors.Invalid) {
+		t.Errorf("expected songs of unknown artists to be invalid, got: %v", err)
+	}
+	if _, err := artistsRepo.Create(ctx, api.Artist{Name: "Artist"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.saveSong(ctx, api.Song{Name: "Song", Duration: "3:00", ArtistId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.saveSong(ctx, api.Song{Name: "Song", Duration: "4:00", ArtistId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	song, err := s.getSongByName(ctx, "Song")
+	if err != nil || song.Id != 1 || song.Duration != "4:00" {
+		t.Errorf("expected the song to be updated, got %+v: %v", song, err)
+	}
+	if _, err := artistsRepo.Delete(ctx, "Artist"); !errors.Is(err, errors.Conflict) {
+		t.Errorf("expected artists with songs not to be deleted, got: %v", err)
+	}
+	if err := s.deleteSong(ctx, "Song"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.deleteSong(ctx, "Song"); !errors.Is(err, errors.NotFound) {
+		t.Errorf("expected the song to be gone, got: %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	log := logstest.New()
+	artistsRepo := artists.NewMemory(log)
+	songsRepo := NewMemory(artistsRepo, log)
+	s, _ := NewWithRepository(songsRepo, log)
+	s.UseCache(cache.NewMemory(10), cache.Options{TTL: time.Minute})
+
+	if _, err := artistsRepo.Create(ctx, api.Artist{Name: "Artist"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.getSongByName(ctx, "Song"); !errors.Is(err, errors.NotFound) {
+		t.Errorf("expected the song not to be there, got: %v", err)
+	}
+	if songs, err := s.getSongs(ctx); err != nil || len(songs) != 0 {
+		t.Errorf("expected no songs, got %+v: %v", songs, err)
+	}
+	if err := s.saveSong(ctx, api.Song{Name: "Song", Duration: "3:00", ArtistId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if song, err := s.getSongByName(ctx, "Song"); err != nil || song.Duration != "3:00" {
+		t.Errorf("expected the missing song to be forgotten after the save, got %+v: %v", song, err)
+	}
+	// written behind the back of the service, so only the TTL would forget it
+	if err := songsRepo.Save(ctx, api.Song{Name: "Song", Duration: "4:00", ArtistId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if song, err := s.getSongByName(ctx, "Song"); err != nil || song.Duration != "3:00" {
+		t.Errorf("expected the song to be cached, got %+v: %v", song, err)
+	}
+	if songs, err := s.getSongs(ctx); err != nil || len(songs) != 1 {
+		t.Errorf("expected the cache to be forgotten after the save, got %+v: %v", songs, err)
+	}
+	if err := s.deleteSong(ctx, "Song"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if songs, err := s.getSongs(ctx); err != nil || len(songs) != 0 {
+		t.Errorf("expected the song to be gone, got %+v: %v", songs, err)
+	}
+}
+
+// TestMemoryOrphans deletes the artist while its songs are being saved,
+// which must leave no song without its artist, like a foreign key
+func TestMemoryOrphans(t *testing.T) {
+	ctx := context.Background()
+	log := logstest.New()
+	for i := 0; i < 50; i++ {
+		artistsRepo := artists.NewMemory(log)
+		songsRepo := NewMemory(artistsRepo, log)
+		artistsRepo.SetInUse(songsRepo.UsesArtist)
+		if _, err := artistsRepo.Create(ctx, api.Artist{Name: "Artist"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			songsRepo.Save(ctx, api.Song{Name: "Song", ArtistId: 1})
+		}()
+		_, delErr := artistsRepo.Delete(ctx, "Artist")
+		<-done
+		songs, _ := songsRepo.Get(ctx, "")
+		if delErr == nil && len(songs) != 0 {
+			t.Fatalf("expected no song once its artist is deleted, got %+v", songs)
+		}
+	}
+}
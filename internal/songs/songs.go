@@ -1,58 +1,109 @@
 package songs
 
 import (
+	"context"
+
 	"github.com/pclavier92/go-restful-api/api"
+	"github.com/pclavier92/go-restful-api/pkg/cache"
 	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/flight"
 	"github.com/pclavier92/go-restful-api/pkg/gin"
 	"github.com/pclavier92/go-restful-api/pkg/logs"
 	"github.com/pclavier92/go-restful-api/pkg/persist"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
 )
 
-type persistor interface {
-	get(name string) (api.Songs, error)
-	create(i api.Song) (bool, error)
-	update(i api.Song) (bool, error)
-	delete(name string) (bool, error)
+// Repository is where the songs are stored. Save and SaveMany fail with
+// errors.Invalid when the artist of a song does not exist.
+type Repository interface {
+	// Get returns every song when name is empty, or the one called name
+	Get(ctx context.Context, name string) (api.Songs, error)
+	// Save creates the song, or updates the one with the same name
+	Save(ctx context.Context, i api.Song) error
+	// SaveMany saves every song like Save, all of them or none
+	SaveMany(ctx context.Context, songs api.Songs) error
+	// Delete removes the song called name, telling if there was one
+	Delete(ctx context.Context, name string) (bool, error)
 }
 
+// noArtist is the field error for songs pointing to artists which don't exist
+var noArtist = errors.FieldError{Field: "artistId", Message: "artist does not exist"}
+
 type db struct {
-	persist.Querier
-	err errors.Structer
+	// Executor runs the queries, either on the connection or on a transaction
+	persist.Executor
+	conn persist.Querier
+	err  errors.Structer
 	logs.Printer
 }
 
+// in returns the same db, running its queries in tx
+func (db db) in(tx *persist.Tx) db {
+	db.Executor = tx
+	return db
+}
+
 // Service works as a holder for dependencies of songs
 type Service struct {
-	db  persistor
-	err errors.Structer
-	log logs.Printer
+	repo Repository
+	err  errors.Structer
+	log  logs.Printer
+	// reads caches the reads until a write changes them, and runs the
+	// identical ones made at the same time only once
+	reads cache.Reads
 }
 
 // API has an HTTP interface for the songs
 type API struct {
-	s   Service
+	s   *Service
 	err errors.Structer
 }
 
 // New will return a new Service for the songs and an API to expose them via HTTP.
 func New(sql persist.Querier, log logs.Printer) (*Service, *API) {
+	e := errors.Pkg("songs", log)
+	return NewWithRepository(db{sql, sql, e.Struct("db"), log}, log)
+}
+
+// NewWithRepository is like New, but keeps the songs in repo instead of the database
+func NewWithRepository(repo Repository, log logs.Printer) (*Service, *API) {
 	e := errors.Pkg("songs", log)
 	s := Service{
-		db:  db{sql, e.Struct("db"), log},
-		err: e.Struct("service"),
-		log: log}
-	return &s, &API{s, e.Struct("api")}
+		repo: repo,
+		err:  e.Struct("service"),
+		log:  log}
+	return &s, &API{&s, e.Struct("api")}
+}
+
+// UseCache keeps the songs read in store for the TTL of opts, forgetting
+// them as soon as they are written through s, and lets clients keep them
+// for its MaxAge. Call it before using s.
+func (s *Service) UseCache(store cache.Store, opts cache.Options) {
+	s.reads.Use(store, opts, s.log)
+}
+
+// Coalescing tells how many reads of the songs shared the query of another
+func (s *Service) Coalescing() flight.Stats {
+	return s.reads.Stats()
 }
 
+// cache keys, the store may be shared with other services, and the keys
+// of the reads being coalesced
+const (
+	allSongs    = "songs:all"
+	songsByName = "songs:name:"
+)
+
 /*---------------   API   ---------------*/
 
 // GetSongs will retrieve the list of songs.
 func (a API) GetSongs(c *gin.Context) (int, interface{}, error) {
 	e := a.err.Fn("GetSongs")
-	songs, err := a.s.getSongs()
+	songs, err := a.s.getSongs(c.Ctx())
 	if err != nil {
-		return 500, songs, e.UK(err)
+		return errors.Status(err), songs, e.UK(err)
 	}
+	c.CacheFor(a.s.reads.MaxAge())
 	return 200, songs, nil
 }
 
@@ -60,12 +111,11 @@ func (a API) GetSongs(c *gin.Context) (int, interface{}, error) {
 func (a API) GetSongByName(c *gin.Context) (int, interface{}, error) {
 	name := c.Param("name")
 	e := a.err.Fn("GetSongByName").Tag("name", name)
-	song, ok, err := a.s.getSongByName(name)
+	song, err := a.s.getSongByName(c.Ctx(), name)
 	if err != nil {
-		return 500, nil, e.UK(err)
-	} else if !ok {
-		return 404, nil, e.NotFound()
+		return errors.Status(err), nil, e.UK(err)
 	}
+	c.CacheFor(a.s.reads.MaxAge())
 	return 200, song, nil
 }
 
@@ -74,14 +124,11 @@ func (a API) CreateSong(c *gin.Context) (int, interface{}, error) {
 	e := a.err.Fn("CreateSong")
 	var song api.Song
 	if err := c.BindJSON(&song); err != nil {
-		return 400, nil, e.JSON(err, "binding")
+		err = e.JSON(err, "binding")
+		return errors.Status(err), nil, err
 	}
-	invalid, err := a.s.saveSong(song)
-	if err != nil {
-		return 500, nil, e.UK(err)
-	}
-	if invalid {
-		return 400, nil, e.DB(err)
+	if err := a.s.saveSong(c.Ctx(), song); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
 	return 201, nil, nil
 }
@@ -91,14 +138,25 @@ func (a API) UpdateSong(c *gin.Context) (int, interface{}, error) {
 	e := a.err.Fn("UpdateSong")
 	var song api.Song
 	if err := c.BindJSON(&song); err != nil {
-		return 400, nil, e.JSON(err, "binding")
+		err = e.JSON(err, "binding")
+		return errors.Status(err), nil, err
 	}
-	invalid, err := a.s.saveSong(song)
-	if err != nil {
-		return 500, nil, e.UK(err)
+	if err := a.s.saveSong(c.Ctx(), song); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
-	if invalid {
-		return 400, nil, e.DB(err)
+	return 201, nil, nil
+}
+
+// SaveSongs will create or update many songs at once. Takes a JSON list of songs.
+func (a API) SaveSongs(c *gin.Context) (int, interface{}, error) {
+	e := a.err.Fn("SaveSongs")
+	var songs api.Songs
+	if err := c.BindJSON(&songs); err != nil {
+		err = e.JSON(err, "binding")
+		return errors.Status(err), nil, err
+	}
+	if err := a.s.saveSongs(c.Ctx(), songs); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
 	return 201, nil, nil
 }
@@ -107,12 +165,8 @@ func (a API) UpdateSong(c *gin.Context) (int, interface{}, error) {
 func (a API) DeleteSong(c *gin.Context) (int, interface{}, error) {
 	name := c.Param("name")
 	e := a.err.Fn("DeleteSong").Tag("name", name)
-	invalid, err := a.s.deleteSong(name)
-	if err != nil {
-		return 500, nil, e.UK(err)
-	}
-	if invalid {
-		return 400, nil, e.DB(err)
+	if err := a.s.deleteSong(c.Ctx(), name); err != nil {
+		return errors.Status(err), nil, e.UK(err)
 	}
 	return 201, nil, nil
 }
@@ -120,117 +174,179 @@ func (a API) DeleteSong(c *gin.Context) (int, interface{}, error) {
 /*--------------- SERVICES ---------------*/
 
 // getSongs will get all songs.
-func (s *Service) getSongs() (api.Songs, error) {
+func (s *Service) getSongs(ctx context.Context) (api.Songs, error) {
+	ctx, span := trace.Start(ctx, "songs.Service.getSongs")
+	defer span.End()
 	e := s.err.Fn("getSongs")
-	songs, err := s.db.get("")
+	var songs api.Songs
+	err := s.reads.Get(ctx, allSongs, &songs, func(ctx context.Context) (interface{}, bool, error) {
+		songs, err := s.repo.Get(ctx, "")
+		return songs, true, err
+	})
 	if err != nil {
 		return api.Songs{}, e.Wrap(err, "getting songs from db")
 	}
 	return songs, nil
 }
 
-// getSongByName will get an song by its name.
-func (s Service) getSongByName(name string) (api.Song, bool, error) {
+// getSongByName will get an song by its name. Fails with errors.NotFound if there is no such song.
+func (s *Service) getSongByName(ctx context.Context, name string) (api.Song, error) {
+	ctx, span := trace.Start(ctx, "songs.Service.getSongByName")
+	defer span.End()
 	e := s.err.Fn("getSongByName").Tag("name", name)
-	songs, err := s.db.get(name)
+	var songs api.Songs
+	err := s.reads.Get(ctx, songsByName+name, &songs, func(ctx context.Context) (interface{}, bool, error) {
+		songs, err := s.repo.Get(ctx, name)
+		return songs, len(songs) > 0, err
+	})
 	if err != nil {
-		return api.Song{}, false, e.Wrap(err, "getting contract from db")
-	} else if len(songs) != 1 {
-		return api.Song{}, false, nil
+		return api.Song{}, e.Wrap(err, "getting song from db")
+	}
+	if len(songs) != 1 {
+		return api.Song{}, e.NotFound()
 	}
 	i := songs[0]
-	return i, true, nil
+	return i, nil
 }
 
 // saveSong will make sure an song is saved in the db
-func (s *Service) saveSong(i api.Song) (invalid bool, err error) {
+func (s *Service) saveSong(ctx context.Context, i api.Song) error {
+	ctx, span := trace.Start(ctx, "songs.Service.saveSong")
+	defer span.End()
 	e := s.err.Fn("saveSong")
-	_, ok, err := s.getSongByName(i.Name)
-	if err != nil {
-		return true, e.Wrap(err, "getting song")
-	} else if ok {
-		ok, err = s.db.update(i)
-	} else {
-		ok, err = s.db.create(i)
-	}
-	if err != nil {
-		return true, e.Wrap(err, "saving song")
-	} else if !ok {
-		return true, nil
-	}
-	return false, nil
+	err := s.repo.Save(ctx, i)
+	s.forget(ctx, api.Songs{i})
+	return e.Wrap(err, "saving song")
+}
+
+// saveSongs will make sure every song is saved in the db, or none
+func (s *Service) saveSongs(ctx context.Context, songs api.Songs) error {
+	ctx, span := trace.Start(ctx, "songs.Service.saveSongs")
+	defer span.End()
+	e := s.err.Fn("saveSongs")
+	err := s.repo.SaveMany(ctx, songs)
+	s.forget(ctx, songs)
+	return e.Wrap(err, "saving songs")
 }
 
-// deleteSong will make sure an song is deleted from the db
-func (s *Service) deleteSong(name string) (invalid bool, err error) {
+// deleteSong will make sure an song is deleted from the db. Fails with errors.NotFound if there is no such song.
+func (s *Service) deleteSong(ctx context.Context, name string) error {
+	ctx, span := trace.Start(ctx, "songs.Service.deleteSong")
+	defer span.End()
 	e := s.err.Fn("deleteSong")
-	ok, err := s.db.delete(name)
+	ok, err := s.repo.Delete(ctx, name)
+	s.forget(ctx, api.Songs{{Name: name}})
 	if err != nil {
-		return true, e.Wrap(err, "deleting song")
+		return e.Wrap(err, "deleting song")
 	} else if !ok {
-		return true, nil
+		return e.NotFound()
 	}
-	return false, nil
+	return nil
+}
+
+// forget takes the songs out of the cache, see cache.Reads.Forget
+func (s *Service) forget(ctx context.Context, songs api.Songs) {
+	keys := []string{allSongs}
+	for _, i := range songs {
+		keys = append(keys, songsByName+i.Name)
+	}
+	s.reads.Forget(ctx, keys...)
 }
 
 /*---------------    DB    ---------------*/
 
-// get will return songs from db
-func (db db) get(name string) (api.Songs, error) {
-	e := db.err.Fn("get").Tag("name", name)
-	var err error
-	var rows *persist.Rows
-	query := `SELECT id, name, duration, artist_id FROM Songs `
+// Get will return songs from db
+func (db db) Get(ctx context.Context, name string) (api.Songs, error) {
+	e := db.err.Fn("Get").Tag("name", name)
+	q := persist.Select("id", "name", "duration", "artist_id").From("Songs")
 	if name != "" {
-		query = query + "WHERE name = ? LIMIT 1"
-		rows, err = db.Query(query, name)
-	} else {
-		rows, err = db.Query(query)
+		q = q.Where(persist.Eq("name", name)).Limit(1)
 	}
+	query, args := q.Build(db.Dialect())
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, e.Wrap(err, "quering songs from table")
 	}
 	songs := api.Songs{}
-	for rows.Next() {
-		i := &api.Song{}
-		err := rows.Scan(&(i.Id), &(i.Name), &(i.Duration), &(i.ArtistId))
-		if err != nil {
-			return nil, e.Wrap(err, "scanning rows")
-		}
-		songs = append(songs, *i)
+	if err := rows.ScanAll(&songs); err != nil {
+		return nil, e.Wrap(err, "scanning rows")
 	}
 	return songs, nil
 }
 
-// create will create a new song in the db
-func (db db) create(i api.Song) (bool, error) {
-	e := db.err.Fn("create")
-	query := `INSERT INTO Songs (name, duration, artist_id) VALUES (?, ?, ?)`
-	_, err := db.Exec(query, i.Name, i.Duration, i.ArtistId)
-	if err != nil {
-		return false, e.Wrap(err, "inserting")
+// Save will create the song, or update it if there is one with the same name,
+// in a single upsert
+func (db db) Save(ctx context.Context, i api.Song) error {
+	e := db.err.Fn("Save").Tag("name", i.Name)
+	return e.Wrap(db.upsert(ctx, upsertOf(api.Songs{i})), "saving")
+}
+
+// SaveMany will create or update every song, in as few upserts as it can,
+// in a transaction when it needs more than one
+func (db db) SaveMany(ctx context.Context, songs api.Songs) error {
+	e := db.err.Fn("SaveMany").Tag("songs", len(songs))
+	if len(songs) == 0 {
+		return nil
+	}
+	q := upsertOf(songs)
+	if q.Statements() == 1 {
+		return e.Wrap(db.upsert(ctx, q), "saving")
 	}
-	return true, nil
+	err := db.conn.WithTx(ctx, func(tx *persist.Tx) error {
+		return db.in(tx).upsert(ctx, q)
+	})
+	return e.Wrap(err, "saving")
 }
 
-// update will update and existing song in the db
-func (db db) update(i api.Song) (bool, error) {
-	e := db.err.Fn("update")
-	query := `UPDATE Songs SET duration = ?, artist_id = ? WHERE name = ?`
-	_, err := db.Exec(query, i.Duration, i.ArtistId, i.Name)
-	if err != nil {
-		return false, e.Wrap(err, "updating")
+// upsertOf returns the insert of the songs which updates the ones whose
+// name is taken
+func upsertOf(songs api.Songs) persist.InsertQuery {
+	var rows [][]interface{}
+	for _, i := range lastOfEachName(songs) {
+		rows = append(rows, []interface{}{i.Name, i.Duration, i.ArtistId})
 	}
-	return true, nil
+	return persist.Insert("Songs").Columns("name", "duration", "artist_id").Rows(rows...).OnConflictUpdate("name")
 }
 
-// delete will delete an existing song from the db
-func (db db) delete(name string) (bool, error) {
-	e := db.err.Fn("delete")
-	query := `DELETE FROM Songs WHERE name = ?`
-	_, err := db.Exec(query, name)
+// upsert runs the upsert q of songs
+func (db db) upsert(ctx context.Context, q persist.InsertQuery) error {
+	e := db.err.Fn("upsert")
+	_, err := persist.ExecInsert(ctx, db, q)
+	if persist.IsForeignKey(err) {
+		return e.InvalidFields("upserting", noArtist)
+	} else if err != nil {
+		return e.Wrap(err, "upserting")
+	}
+	return nil
+}
+
+// lastOfEachName drops the songs saved again later on, as an upsert can't
+// touch the same row twice
+func lastOfEachName(songs api.Songs) api.Songs {
+	last := map[string]int{}
+	for i, s := range songs {
+		last[s.Name] = i
+	}
+	var unique api.Songs
+	for i, s := range songs {
+		if last[s.Name] == i {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// Delete will delete an existing song from the db
+func (db db) Delete(ctx context.Context, name string) (bool, error) {
+	e := db.err.Fn("Delete")
+	query, args := persist.Delete("Songs").Where(persist.Eq("name", name)).Build(db.Dialect())
+	r, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return false, e.Wrap(err, "deleting")
 	}
-	return true, nil
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, e.Wrap(err, "counting deleted rows")
+	}
+	return n > 0, nil
 }
@@ -0,0 +1,21 @@
+// Package migrations holds the migrations of the Music database, embedded
+// in the binary, with a folder for each dialect. Add a new version to every
+// folder with both an up and a down file, named like 0004_add_song_year.up.sql,
+// and never edit one already applied.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var all embed.FS
+
+// For returns the migrations written for the dialect, like mysql
+func For(dialect string) (fs.FS, error) {
+	if _, err := fs.Stat(all, dialect); err != nil {
+		return nil, err
+	}
+	return fs.Sub(all, dialect)
+}
@@ -0,0 +1,7 @@
+-- IF NOT EXISTS lets databases made with the old scripts/db_schema.sql be adopted
+CREATE TABLE IF NOT EXISTS Users (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `username` varchar(256) DEFAULT NULL,
+  `password` varchar(256) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS Songs (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(256) DEFAULT NULL,
+  `duration` varchar(256) DEFAULT NULL,
+  `artist_id` int(11) NOT NULL,
+  PRIMARY KEY (`id`),
+  FOREIGN KEY `FK_Songs_Artist` (`artist_id`) REFERENCES `Artists` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,5 @@
+-- anything latin1 can't keep is lost
+ALTER TABLE Songs CONVERT TO CHARACTER SET latin1;
+ALTER TABLE Artists CONVERT TO CHARACTER SET latin1;
+ALTER TABLE Users CONVERT TO CHARACTER SET latin1;
+ALTER DATABASE CHARACTER SET latin1;
@@ -0,0 +1,5 @@
+-- latin1 can't keep emojis, or most of the world's song titles
+ALTER DATABASE CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+ALTER TABLE Users CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+ALTER TABLE Artists CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+ALTER TABLE Songs CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
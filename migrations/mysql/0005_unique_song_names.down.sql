@@ -0,0 +1,3 @@
+ALTER TABLE Songs DROP INDEX `UK_Songs_name`;
+INSERT INTO Songs SELECT * FROM Songs_duplicates;
+DROP TABLE Songs_duplicates;
@@ -0,0 +1,7 @@
+-- songs are saved by name, so only the first of each name is kept. The
+-- others are moved to Songs_duplicates, which the down migration puts back.
+CREATE TABLE Songs_duplicates LIKE Songs;
+INSERT INTO Songs_duplicates
+  SELECT * FROM Songs WHERE name IS NOT NULL AND id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM Songs GROUP BY name) k);
+DELETE s FROM Songs s JOIN Songs_duplicates d ON s.id = d.id;
+ALTER TABLE Songs ADD UNIQUE KEY `UK_Songs_name` (`name`);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS Users (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(256) DEFAULT NULL,
+  password VARCHAR(256) DEFAULT NULL
+);
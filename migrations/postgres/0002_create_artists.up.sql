@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS Artists (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(256) DEFAULT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS Songs (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(256) DEFAULT NULL,
+  duration VARCHAR(256) DEFAULT NULL,
+  artist_id INTEGER NOT NULL REFERENCES Artists (id)
+);
@@ -0,0 +1 @@
+-- PostgreSQL is UTF-8 already, this keeps the versions of every database in step
@@ -0,0 +1,6 @@
+-- songs are saved by name, so only the first of each name is kept. The
+-- others are moved to Songs_duplicates, which the down migration puts back.
+CREATE TABLE Songs_duplicates AS
+  SELECT * FROM Songs WHERE name IS NOT NULL AND id NOT IN (SELECT MIN(id) FROM Songs GROUP BY name);
+DELETE FROM Songs WHERE id IN (SELECT id FROM Songs_duplicates);
+CREATE UNIQUE INDEX UK_Songs_name ON Songs (name);
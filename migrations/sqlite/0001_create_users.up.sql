@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS Users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(256) DEFAULT NULL,
+  password VARCHAR(256) DEFAULT NULL
+);
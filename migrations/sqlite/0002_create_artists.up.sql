@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS Artists (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(256) DEFAULT NULL
+);
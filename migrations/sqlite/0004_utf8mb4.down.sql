@@ -0,0 +1 @@
+-- SQLite is UTF-8 already, this keeps the versions of every database in step
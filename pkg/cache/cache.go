@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// Store keeps values by key for a while. Memory is the one in this process,
+// an external one, like Redis or Memcached, lets every replica share it.
+type Store interface {
+	// Get returns the value of key, and false if there is none or it expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set keeps value as the one of key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete forgets the keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Options says how a service caches its reads
+type Options struct {
+	// TTL is how long a value is kept, in case a write is not seen
+	TTL time.Duration
+	// MaxAge is how long clients and proxies may keep the responses
+	MaxAge time.Duration
+	// Primary fills the cache reading from the primary database. A replica
+	// behind the writes may fill it with a value older than the last one,
+	// which is kept for the whole TTL.
+	Primary bool
+}
+
+// JSON keeps values encoded as JSON in a Store. A cache must never fail a
+// request, so the errors of the store are logged and taken as misses.
+// A nil JSON caches nothing.
+type JSON struct {
+	store Store
+	ttl   time.Duration
+	log   logs.Printer
+	mu    sync.Mutex
+	// fills are the keys being read to be set, see Fill
+	fills map[string]*fill
+}
+
+// fill counts the reads of a key, and bumps gen when the key is deleted
+type fill struct {
+	reads int
+	gen   uint64
+}
+
+// NewJSON returns a JSON keeping its values in store for ttl
+func NewJSON(store Store, ttl time.Duration, log logs.Printer) *JSON {
+	return &JSON{store: store, ttl: ttl, log: log, fills: map[string]*fill{}}
+}
+
+// Get decodes the value of key into dest, telling if there was one
+func (j *JSON) Get(ctx context.Context, key string, dest interface{}) bool {
+	if j == nil {
+		return false
+	}
+	b, ok, err := j.store.Get(ctx, key)
+	if err != nil {
+		j.log.Warn("Could not read from cache", logs.I{"key": key, "error": err.Error()})
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(b, dest); err != nil {
+		j.log.Warn("Could not decode cached value", logs.I{"key": key, "error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// Set keeps v as the value of key
+func (j *JSON) Set(ctx context.Context, key string, v interface{}) {
+	if j == nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = j.store.Set(ctx, key, b, j.ttl)
+	}
+	if err != nil {
+		j.log.Warn("Could not write to cache", logs.I{"key": key, "error": err.Error()})
+	}
+}
+
+// Delete forgets the keys, as their values changed
+func (j *JSON) Delete(ctx context.Context, keys ...string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	for _, k := range keys {
+		if f, ok := j.fills[k]; ok {
+			f.gen++
+		}
+	}
+	j.mu.Unlock()
+	if err := j.store.Delete(ctx, keys...); err != nil {
+		j.log.Warn("Could not delete from cache", logs.I{"keys": keys, "error": err.Error()})
+	}
+}
+
+// Fill is the value of a key being read from where it comes from, to be
+// set once read. A read which started before a write may end after the
+// write deleted the key, so its value is only set if the key was not
+// deleted meanwhile.
+type Fill struct {
+	j   *JSON
+	key string
+	f   *fill
+	gen uint64
+}
+
+// Fill starts reading the value of key. It must end with Set, or with
+// Drop if the read failed.
+func (j *JSON) Fill(key string) *Fill {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, ok := j.fills[key]
+	if !ok {
+		f = &fill{}
+		j.fills[key] = f
+	}
+	f.reads++
+	return &Fill{j, key, f, f.gen}
+}
+
+// Set keeps v, which was read, as the value of the key, unless it was
+// deleted since the read started
+func (f *Fill) Set(ctx context.Context, v interface{}) {
+	if f == nil {
+		return
+	}
+	defer f.end()
+	if !f.current() {
+		return
+	}
+	f.j.Set(ctx, f.key, v)
+	// deleted while it was being set, maybe before it was
+	if !f.current() {
+		f.j.Delete(ctx, f.key)
+	}
+}
+
+// Drop ends a read without setting its value, as it failed
+func (f *Fill) Drop() {
+	if f == nil {
+		return
+	}
+	f.end()
+}
+
+func (f *Fill) end() {
+	f.j.mu.Lock()
+	defer f.j.mu.Unlock()
+	if f.f.reads--; f.f.reads == 0 {
+		delete(f.j.fills, f.key)
+	}
+}
+
+// current tells if the key was not deleted since the read started
+func (f *Fill) current() bool {
+	f.j.mu.Lock()
+	defer f.j.mu.Unlock()
+	return f.f.gen == f.gen
+}
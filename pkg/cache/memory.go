@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Memory is a Store in this process, keeping up to size values and
+// forgetting the least recently used ones first. Every replica of the app
+// has its own, so a change made through one of them is only seen by the
+// others once the values expire. It is safe to use from many goroutines.
+type Memory struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // of *entry, the most recently used first
+	byKey map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewMemory returns an empty Memory for up to size values
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:  size,
+		lru:   list.New(),
+		byKey: map[string]*list.Element{},
+		now:   time.Now,
+	}
+}
+
+// Get returns the value of key, and false if there is none or it expired
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.byKey[key]
+	if !ok {
+		return nil, false, nil
+	}
+	ent := e.Value.(*entry)
+	if m.now().After(ent.expires) {
+		m.remove(e)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(e)
+	return ent.value, true, nil
+}
+
+// Set keeps value as the one of key for ttl
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.byKey[key]; ok {
+		m.remove(e)
+	}
+	m.byKey[key] = m.lru.PushFront(&entry{key, value, m.now().Add(ttl)})
+	for m.lru.Len() > m.size {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// Delete forgets the keys
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		if e, ok := m.byKey[k]; ok {
+			m.remove(e)
+		}
+	}
+	return nil
+}
+
+// Len returns how many values are kept, expired or not
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memory) remove(e *list.Element) {
+	delete(m.byKey, m.lru.Remove(e).(*entry).key)
+}
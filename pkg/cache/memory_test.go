@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	m.Set(ctx, "a", []byte("1"), time.Minute)
+	m.Set(ctx, "b", []byte("2"), time.Second)
+	if v, ok, _ := m.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("expected a to be 1, got %q", v)
+	}
+	// b is now the least recently used
+	m.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := m.Get(ctx, "b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := m.Get(ctx, "a"); ok {
+		t.Errorf("expected a to expire")
+	}
+	if m.Len() != 1 {
+		t.Errorf("expected only c to be kept, got %d values", m.Len())
+	}
+	m.Delete(ctx, "c")
+	if _, ok, _ := m.Get(ctx, "c"); ok {
+		t.Errorf("expected c to be deleted")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	ctx := context.Background()
+	var nothing *JSON
+	nothing.Set(ctx, "a", 1)
+	var n int
+	if nothing.Get(ctx, "a", &n) {
+		t.Errorf("expected a nil JSON to cache nothing")
+	}
+	j := NewJSON(NewMemory(10), time.Minute, logstest.New())
+	j.Set(ctx, "a", []int{1, 2})
+	var got []int
+	if !j.Get(ctx, "a", &got) || len(got) != 2 || got[1] != 2 {
+		t.Errorf("expected [1 2], got %v", got)
+	}
+	if j.Get(ctx, "a", &n) {
+		t.Errorf("expected a value of another type to be a miss")
+	}
+}
+
+func TestFill(t *testing.T) {
+	ctx := context.Background()
+	j := NewJSON(NewMemory(10), time.Minute, logstest.New())
+	var n int
+
+	// a read which started before the write ends after it
+	before := j.Fill("a")
+	j.Delete(ctx, "a")
+	after := j.Fill("a")
+	before.Set(ctx, 1)
+	if j.Get(ctx, "a", &n) {
+		t.Errorf("expected the value read before the delete not to be set, got %d", n)
+	}
+	after.Set(ctx, 2)
+	if !j.Get(ctx, "a", &n) || n != 2 {
+		t.Errorf("expected the value read after the delete, got %d", n)
+	}
+	j.Fill("b").Drop()
+	if len(j.fills) != 0 {
+		t.Errorf("expected no reads left, got %v", j.fills)
+	}
+	var nothing *JSON
+	nothing.Fill("a").Set(ctx, 1)
+}
+
+func TestReads(t *testing.T) {
+	ctx := context.Background()
+	var r Reads
+	r.Use(NewMemory(10), Options{TTL: time.Minute, MaxAge: time.Second}, logstest.New())
+	reads := 0
+	read := func(found bool) Read {
+		return func(ctx context.Context) (interface{}, bool, error) {
+			reads++
+			if !found {
+				return []int{}, false, nil
+			}
+			return []int{reads}, true, nil
+		}
+	}
+	var got []int
+	for i := 0; i < 2; i++ {
+		if err := r.Get(ctx, "missing", &got, read(false)); err != nil || len(got) != 0 {
+			t.Fatalf("expected nothing, got %v: %v", got, err)
+		}
+	}
+	if reads != 2 {
+		t.Errorf("expected what is not found not to be cached, read %d times", reads)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Get(ctx, "a", &got, read(true)); err != nil || len(got) != 1 || got[0] != 3 {
+			t.Fatalf("expected the first read to be cached, got %v: %v", got, err)
+		}
+	}
+	r.Forget(ctx, "a")
+	if err := r.Get(ctx, "a", &got, read(true)); err != nil || len(got) != 1 || got[0] != 4 {
+		t.Errorf("expected a new read once forgotten, got %v: %v", got, err)
+	}
+	if r.MaxAge() != time.Second || r.Stats().Calls != 4 {
+		t.Errorf("unexpected max age %v and stats %+v", r.MaxAge(), r.Stats())
+	}
+}
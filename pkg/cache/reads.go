@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/flight"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/persist"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+// Read reads a value from where it comes from, telling if it was found.
+// Values which are not found are returned but never cached, or anyone
+// asking for made up keys would push the real values out of the cache.
+type Read func(ctx context.Context) (v interface{}, found bool, err error)
+
+// Reads reads the values of a service through a cache, keeping them until
+// a write changes them. The identical reads made at the same time only
+// read once, so their values are shared and must not be changed.
+// The zero value caches nothing, but still coalesces the reads.
+type Reads struct {
+	cache *JSON
+	opts  Options
+	calls flight.Group
+}
+
+// Use keeps the values read in store, see Options. Call it before reading.
+func (r *Reads) Use(store Store, opts Options, log logs.Printer) {
+	r.cache = NewJSON(store, opts.TTL, log)
+	r.opts = opts
+}
+
+// MaxAge is how long clients and proxies may keep the values read
+func (r *Reads) MaxAge() time.Duration {
+	return r.opts.MaxAge
+}
+
+// Stats tells how many reads shared the one of another
+func (r *Reads) Stats() flight.Stats {
+	return r.calls.Stats()
+}
+
+// Get sets dest, a pointer, to the value of key: the cached one if there
+// is one, or the one returned by read otherwise. The reads which started
+// before a write deleted the key are not cached, see Fill.
+func (r *Reads) Get(ctx context.Context, key string, dest interface{}, read Read) error {
+	if r.cache.Get(ctx, key, dest) {
+		return nil
+	}
+	v, shared, err := r.calls.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		fill := r.cache.Fill(key)
+		if r.opts.Primary {
+			ctx = persist.Primary(ctx)
+		}
+		v, found, err := read(ctx)
+		if err != nil || !found {
+			fill.Drop()
+			return v, err
+		}
+		fill.Set(ctx, v)
+		return v, nil
+	})
+	trace.FromContext(ctx).SetAttr("coalesced", shared)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		reflect.ValueOf(dest).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// Forget takes the keys out of the cache, and makes the next reads of them
+// wait for no read started before. Call it after every write, even when it
+// fails, as it may have been done before failing.
+func (r *Reads) Forget(ctx context.Context, keys ...string) {
+	r.calls.Forget(keys...)
+	r.cache.Delete(ctx, keys...)
+}
@@ -0,0 +1,103 @@
+package errors
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// debug is 1 when chains should capture the whole goroutine stack
+var debug int32
+
+// SetDebug turns on capturing the stack trace of every new chain and
+// adding it to its Report. Stacks are expensive, so only use it in
+// local and test scopes. They are never shown to the user.
+func SetDebug(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&debug, v)
+}
+
+func debugging() bool {
+	return atomic.LoadInt32(&debug) == 1
+}
+
+// thisDir is the directory of this package, so we can skip its frames
+var thisDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// caller is where in the code a chain was created
+type caller struct {
+	fn   string
+	file string
+	line int
+}
+
+func (c caller) String() string {
+	if c.file == "" {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s:%d)", c.fn, c.file, c.line)
+}
+
+// capture returns the first caller outside this package, and the
+// whole stack if we are debugging.
+func capture() (caller, []uintptr) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	pcs = pcs[:n]
+	frames := runtime.CallersFrames(pcs)
+	var c caller
+	skipped := 0
+	for {
+		f, more := frames.Next()
+		if filepath.Dir(f.File) != thisDir || strings.HasSuffix(f.File, "_test.go") {
+			c = caller{shortFn(f.Function), shortFile(f.File), f.Line}
+			break
+		}
+		skipped++
+		if !more {
+			break
+		}
+	}
+	if !debugging() {
+		return c, nil
+	}
+	if skipped < len(pcs) {
+		pcs = pcs[skipped:]
+	}
+	return c, pcs
+}
+
+// stackOf returns the stack trace captured with a chain, one function per line
+func stackOf(pcs []uintptr) []string {
+	if len(pcs) == 0 {
+		return nil
+	}
+	var stack []string
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		stack = append(stack, fmt.Sprintf("%s (%s:%d)", f.Function, shortFile(f.File), f.Line))
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// shortFn turns github.com/user/repo/internal/songs.(*Service).saveSong into songs.(*Service).saveSong
+func shortFn(fn string) string {
+	return fn[strings.LastIndex(fn, "/")+1:]
+}
+
+// shortFile keeps only the last directory of the file, like songs/songs.go
+func shortFile(file string) string {
+	return filepath.Join(filepath.Base(filepath.Dir(file)), filepath.Base(file))
+}
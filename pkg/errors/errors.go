@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pclavier92/go-restful-api/pkg/logs"
@@ -42,7 +43,7 @@ type Struct struct {
 
 // Fn will give you something to wrap the error in your functions
 func (s Struct) Fn(fn string) Function {
-	return Function{s, make(map[string]interface{}), fn}
+	return Function{s, nil, fn}
 }
 
 // Creator is a type which can create errors
@@ -56,25 +57,53 @@ type Creator interface {
 	UK(e error) *Chain
 }
 
-// Function wraps errors inside a single function
+// Function wraps errors inside a single function.
+// It is immutable, so it is safe to share it between goroutines.
 type Function struct {
 	strct Struct
-	tags  map[string]interface{}
+	tags  []tag
 	name  string
 }
 
-func (f Function) unsafeWrap(e error, ctx string, external string) *Chain {
-	return &Chain{e, external, ctx, f, f.strct, f.strct.pkg}
+type tag struct {
+	key   string
+	value interface{}
+}
+
+// Stable codes sent to the clients along with the external message, so they can switch on them
+const (
+	CodeUnknown      = "unknown"
+	CodeInvalidJSON  = "invalid-json"
+	CodeNotFound     = "not-found"
+	CodeDatabase     = "database"
+	CodeInvalidData  = "invalid-data"
+	CodeConflict     = "conflict"
+	CodeUnauthorized = "unauthorized"
+)
+
+// FieldError tells the client which field of its request was wrong and why
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (f Function) unsafeWrap(e error, ctx string, external string, code string, kind Kind) *Chain {
+	at, stack := capture()
+	return &Chain{e, external, code, nil, kind, ctx, f, f.strct, f.strct.pkg, at, stack}
 }
 
 // New will return a new error chain
 func (f Function) New(ctx string) error {
-	return f.unsafeWrap(errors.New(ctx), ctx, "")
+	return f.unsafeWrap(errors.New(ctx), ctx, "", "", "")
 }
 
-// Tag will add a tag to a function error handler
+// Tag will return a copy of the function error handler with a new tag.
+// The original handler, and every error created from it, are left untouched.
+// Sensitive values, like passwords, are masked right away.
 func (f Function) Tag(t string, v interface{}) Function {
-	f.tags[t] = v
+	tags := make([]tag, len(f.tags), len(f.tags)+1)
+	copy(tags, f.tags)
+	f.tags = append(tags, tag{t, logs.Redact().Field(t, v)})
 	return f
 }
 
@@ -83,92 +112,238 @@ func (f Function) Wrap(e error, ctx string, args ...interface{}) error {
 	if e == nil {
 		return nil
 	}
-	return f.unsafeWrap(e, fmt.Sprintf(ctx, args...), "")
+	return f.unsafeWrap(e, fmt.Sprintf(ctx, args...), "", "", "")
 }
 
 // JSON will wrap an error for display in the API blaming a JSON received
 func (f Function) JSON(e error, ctx string) error {
-	return f.unsafeWrap(e, ctx, "invalid json")
+	return f.unsafeWrap(e, ctx, "invalid json", CodeInvalidJSON, Invalid)
 }
 
 // NotFound will wrap an error saying the resource was not found
 func (f Function) NotFound() error {
-	return f.unsafeWrap(f.New("not found"), "", "resource not found")
+	return f.unsafeWrap(f.New("not found"), "", "resource not found", CodeNotFound, NotFound)
 }
 
-// UK will tell the user the problem is unknown
+// UK will tell the user the problem is unknown. If e was already
+// classified with a Kind, the user will get its external message and code instead.
 func (f Function) UK(e error) error {
 	if e == nil {
 		e = f.New("unkown error")
 	}
-	return f.unsafeWrap(e, "", "unknown error")
+	for prev := e; prev != nil; prev = Unwrap(prev) {
+		if c, ok := prev.(*Chain); ok && c.External != "" && c.kind != "" {
+			w := f.unsafeWrap(e, "", c.External, c.Code, "")
+			w.Fields = c.Fields
+			return w
+		}
+	}
+	return f.unsafeWrap(e, "", "unknown error", CodeUnknown, "")
 }
 
 // DB will wrap an error and add to the context that there was a problem in the database
 func (f Function) DB(e error) error {
-	return f.unsafeWrap(e, "", "problem in database")
+	return f.unsafeWrap(e, "", "problem in database", CodeDatabase, "")
 }
 
 // Invalid will create a new error chain and say context is the
 func (f Function) Invalid(ctx string) error {
-	return f.unsafeWrap(errors.New(ctx), ctx, "invalid data sent")
+	return f.unsafeWrap(errors.New(ctx), ctx, "invalid data sent", CodeInvalidData, Invalid)
+}
+
+// InvalidFields is like Invalid, but also tells the user which fields were wrong
+func (f Function) InvalidFields(ctx string, fields ...FieldError) error {
+	c := f.unsafeWrap(errors.New(ctx), ctx, "invalid data sent", CodeInvalidData, Invalid)
+	c.Fields = fields
+	return c
+}
+
+// Conflict will wrap an error saying the request clashes with the current state of a resource
+func (f Function) Conflict(e error, ctx string) error {
+	return f.unsafeWrap(e, ctx, "conflict with the current state of the resource", CodeConflict, Conflict)
+}
+
+// Unauthorized will create a new error chain saying the user can't do what was requested
+func (f Function) Unauthorized(ctx string) error {
+	return f.unsafeWrap(errors.New(ctx), ctx, "unauthorized", CodeUnauthorized, Unauthorized)
 }
 
+// Mark will wrap an error classifying it with a kind, without telling anything to the user
+func (f Function) Mark(e error, k Kind, ctx string) error {
+	if e == nil {
+		return nil
+	}
+	return f.unsafeWrap(e, ctx, "", "", k)
+}
+
+// Chain is an error which remembers every function it went through
 type Chain struct {
 	previous error
+	// External is the message which is safe to show to the user
 	External string
-	ctx      string
-	fn       Function
-	strct    Struct
-	Pkg      Package
+	// Code is a stable identifier of the kind of error, empty for internal errors
+	Code string
+	// Fields are the invalid fields of the request, if any
+	Fields []FieldError
+	kind   Kind
+	ctx    string
+	fn     Function
+	strct  Struct
+	Pkg    Package
+	at     caller
+	stack  []uintptr
+}
+
+// Frame is a function an error chain went through
+type Frame struct {
+	Package  string `json:"package"`
+	Struct   string `json:"struct"`
+	Function string `json:"function"`
+	// Caller is the real function which created the chain, with its file and line
+	Caller  string                 `json:"caller"`
+	Context string                 `json:"context,omitempty"`
+	Tags    map[string]interface{} `json:"tags,omitempty"`
+}
+
+// Report is a structured representation of an error chain, ready to be logged as JSON
+type Report struct {
+	// Original is the message of the error which started the chain
+	Original string `json:"original"`
+	// External is the message which was shown to the user, if any
+	External string `json:"external,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Kind     Kind   `json:"kind,omitempty"`
+	// Frames go from the outermost function to the one which created the chain
+	Frames []Frame `json:"frames"`
+	// Tags are the tags of every frame together. Inner frames win on clashes.
+	Tags map[string]interface{} `json:"tags,omitempty"`
+	// Stack is the goroutine stack where the chain started. Only captured with SetDebug.
+	Stack []string `json:"stack,omitempty"`
+}
+
+// Describe returns the Report of err. Errors which are not chains only have an Original.
+func Describe(err error) Report {
+	if err == nil {
+		return Report{Original: "nil"}
+	}
+	if c, ok := err.(*Chain); ok {
+		return c.Report()
+	}
+	return Report{Original: err.Error()}
 }
 
-func (w Chain) formatTags(tags map[string]interface{}) string {
+// Report returns a structured representation of the chain
+func (w Chain) Report() Report {
+	r := Report{External: w.External, Code: w.Code, Kind: KindOf(&w), Tags: map[string]interface{}{}}
+	var original error
+	for c := &w; c != nil; {
+		f := Frame{
+			Package:  c.Pkg.name,
+			Struct:   c.strct.name,
+			Function: c.fn.name,
+			Caller:   c.at.String(),
+			Context:  c.ctx,
+		}
+		if len(c.fn.tags) > 0 {
+			f.Tags = make(map[string]interface{}, len(c.fn.tags))
+			for _, t := range c.fn.tags {
+				f.Tags[t.key] = t.value
+				r.Tags[t.key] = t.value
+			}
+		}
+		r.Frames = append(r.Frames, f)
+		prev, ok := c.previous.(*Chain)
+		if !ok {
+			original = c.previous
+			r.Stack = stackOf(c.stack)
+		}
+		c = prev
+	}
+	r.Original = "nil"
+	if original != nil {
+		r.Original = logs.Redact().String(original.Error())
+	}
+	return r
+}
+
+func formatTags(tags map[string]interface{}) string {
+	keys := make([]string, 0, len(tags))
+	for t := range tags {
+		keys = append(keys, t)
+	}
+	sort.Strings(keys)
 	var fmtTags string
-	for t, v := range w.fn.tags {
+	for _, t := range keys {
 		if fmtTags == "" {
-			fmtTags += fmt.Sprintf("%s->%v", t, v)
+			fmtTags += fmt.Sprintf("%s->%v", t, tags[t])
 		} else {
-			fmtTags += fmt.Sprintf(", %s->%v", t, v)
+			fmtTags += fmt.Sprintf(", %s->%v", t, tags[t])
 		}
 	}
 	return fmtTags
 }
 
 func (w Chain) Error() string {
-	allTags := w.fn.tags
-	stack := fmt.Sprintf("%s.%s.%s", w.Pkg.name, w.fn.strct.name, w.fn.name)
-	ctx := w.ctx
-	original := w.previous
-	prev, ok := w.previous.(*Chain)
-	for ok {
-		stack += fmt.Sprintf(" <- %s.%s.%s", prev.Pkg.name, prev.strct.name, prev.fn.name)
-		ctx += fmt.Sprintf(" <- %s", prev.ctx)
-		for t, v := range prev.fn.tags {
-			allTags[t] = v
-		}
-		if _, ok = prev.previous.(*Chain); ok {
-			prev = prev.previous.(*Chain)
-		} else {
-			original = prev.previous
+	r := w.Report()
+	var stack, ctx string
+	for i, f := range r.Frames {
+		if i > 0 {
+			stack += " <- "
+			ctx += " <- "
 		}
-	}
-	tags := w.formatTags(allTags)
-	origin := "nil"
-	if original != nil {
-		origin = original.Error()
+		stack += f.Caller
+		ctx += f.Context
 	}
 	return fmt.Sprintf(
 		"ERROR %s | CONTEXT %s | TAGS: %s | STACK: %s",
-		origin, ctx, tags, stack)
+		r.Original, ctx, formatTags(r.Tags), stack)
 }
 
+// Unwrap returns the error this chain wraps, so the standard errors.Is and errors.As work
+func (w *Chain) Unwrap() error {
+	return w.previous
+}
+
+// Is tells if the chain was classified with target, when target is a Kind
+func (w *Chain) Is(target error) bool {
+	k, ok := target.(Kind)
+	return ok && w.kind != "" && w.kind == k
+}
+
+// As will set target to the kind of the chain, when target is a *Kind
+func (w *Chain) As(target interface{}) bool {
+	k, ok := target.(*Kind)
+	if !ok || w.kind == "" {
+		return false
+	}
+	*k = w.kind
+	return true
+}
+
+// OriginalError returns the message of the first error in the chain.
+// Prefer Is and As over comparing strings with it.
 func OriginalError(err error) string {
 	original := strings.TrimPrefix(err.Error(), "ERROR ")
 	original = strings.SplitAfter(original, " | CONTEXT ")[0]
 	return strings.TrimSuffix(original, " | CONTEXT ")
 }
 
+// New returns a plain error with msg
 func New(msg string) error {
 	return errors.New(msg)
 }
+
+// Is is the standard errors.Is, so you don't have to import both packages
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As is the standard errors.As, so you don't have to import both packages
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// Unwrap is the standard errors.Unwrap, so you don't have to import both packages
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
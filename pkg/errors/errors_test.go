@@ -0,0 +1,121 @@
+package errors
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+func testFn(t *testing.T, name string) Function {
+	t.Helper()
+	log, err := logs.New("test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return Pkg("errorstest", log).Struct("test").Fn(name)
+}
+
+func TestUnwrap(t *testing.T) {
+	inner := testFn(t, "inner").Wrap(sql.ErrNoRows, "querying")
+	outer := testFn(t, "outer").Wrap(inner, "getting")
+	if !Is(outer, sql.ErrNoRows) {
+		t.Errorf("expected chain to wrap sql.ErrNoRows, got: %s", outer)
+	}
+	var c *Chain
+	if !As(outer, &c) || c != outer {
+		t.Errorf("expected As to find the outer chain")
+	}
+}
+
+func TestKinds(t *testing.T) {
+	cases := []struct {
+		err    error
+		kind   Kind
+		status int
+	}{
+		{testFn(t, "notFound").NotFound(), NotFound, 404},
+		{testFn(t, "invalid").Invalid("bad name"), Invalid, 400},
+		{testFn(t, "json").JSON(New("eof"), "binding"), Invalid, 400},
+		{testFn(t, "conflict").Conflict(New("duplicated"), "inserting"), Conflict, 409},
+		{testFn(t, "unauthorized").Unauthorized("no token"), Unauthorized, 401},
+		{testFn(t, "wrap").Wrap(New("boom"), "failing"), "", 500},
+	}
+	for _, c := range cases {
+		wrapped := testFn(t, "outer").UK(testFn(t, "middle").Wrap(c.err, "wrapping"))
+		if got := KindOf(wrapped); got != c.kind {
+			t.Errorf("wrong kind for %s, got: %q, wanted: %q", c.err, got, c.kind)
+		}
+		if c.kind != "" && !Is(wrapped, c.kind) {
+			t.Errorf("expected %s to be of kind %q", c.err, c.kind)
+		}
+		if got := Status(wrapped); got != c.status {
+			t.Errorf("wrong status for %s, got: %d, wanted: %d", c.err, got, c.status)
+		}
+	}
+}
+
+func TestUKKeepsExternal(t *testing.T) {
+	field := FieldError{Field: "artistId", Message: "artist does not exist"}
+	inner := testFn(t, "create").InvalidFields("inserting", field)
+	uk := testFn(t, "CreateSong").UK(testFn(t, "saveSong").Wrap(inner, "saving")).(*Chain)
+	if uk.Code != CodeInvalidData || uk.External != "invalid data sent" {
+		t.Errorf("expected UK to keep the code and message of the classified error, got: %s, %s", uk.Code, uk.External)
+	}
+	if len(uk.Fields) != 1 || uk.Fields[0] != field {
+		t.Errorf("expected UK to keep the invalid fields, got: %v", uk.Fields)
+	}
+	uk = testFn(t, "GetSongs").UK(New("boom")).(*Chain)
+	if uk.Code != CodeUnknown || uk.External != "unknown error" {
+		t.Errorf("expected an unknown error, got: %s, %s", uk.Code, uk.External)
+	}
+}
+
+func TestTagDoesNotLeak(t *testing.T) {
+	f := testFn(t, "tags")
+	a := f.Tag("a", 1)
+	b := f.Tag("b", 2)
+	if len(f.tags) != 0 {
+		t.Errorf("expected the original handler to have no tags, got: %v", f.tags)
+	}
+	if len(a.tags) != 1 || len(b.tags) != 1 || a.tags[0].key != "a" || b.tags[0].key != "b" {
+		t.Errorf("expected copies to only have their own tags, got: %v and %v", a.tags, b.tags)
+	}
+}
+
+func TestReport(t *testing.T) {
+	inner := testFn(t, "inner").Tag("name", "x").Wrap(sql.ErrNoRows, "querying")
+	outer := testFn(t, "outer").Tag("id", 1).Wrap(inner, "getting")
+	r := Describe(outer)
+	if r.Original != sql.ErrNoRows.Error() {
+		t.Errorf("wrong original error, got: %s", r.Original)
+	}
+	if len(r.Frames) != 2 || r.Frames[0].Function != "outer" || r.Frames[1].Function != "inner" {
+		t.Errorf("wrong frames, got: %+v", r.Frames)
+	}
+	if r.Tags["name"] != "x" || r.Tags["id"] != 1 {
+		t.Errorf("wrong tags, got: %v", r.Tags)
+	}
+	want := "ERROR " + sql.ErrNoRows.Error() + " | CONTEXT getting <- querying | TAGS: id->1, name->x | STACK: "
+	if got := outer.Error(); !strings.HasPrefix(got, want) {
+		t.Errorf("wrong message, got:\n %s\n wanted prefix:\n %s", got, want)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	SetDebug(false)
+	err := testFn(t, "caller").New("boom").(*Chain)
+	if !strings.HasPrefix(err.at.String(), "errors.TestCaller (errors/errors_test.go:") {
+		t.Errorf("wrong caller, got: %s", err.at)
+	}
+	if r := err.Report(); len(r.Stack) != 0 {
+		t.Errorf("expected no stack when not debugging, got: %v", r.Stack)
+	}
+	SetDebug(true)
+	defer SetDebug(false)
+	r := testFn(t, "caller").New("boom").(*Chain).Report()
+	if len(r.Stack) == 0 || !strings.HasPrefix(r.Stack[0], "github.com/pclavier92/go-restful-api/pkg/errors.TestCaller") {
+		t.Errorf("expected stack to start in the test, got: %v", r.Stack)
+	}
+}
@@ -0,0 +1,43 @@
+package errors
+
+import "net/http"
+
+// Kind classifies an error. Kinds are errors themselves, so you can
+// ask if a chain is of a kind with Is(err, NotFound).
+type Kind string
+
+func (k Kind) Error() string { return string(k) }
+
+// Kinds of errors the API knows how to answer
+const (
+	NotFound     Kind = "not found"
+	Conflict     Kind = "conflict"
+	Invalid      Kind = "invalid"
+	Unauthorized Kind = "unauthorized"
+)
+
+// KindOf returns the kind of the outermost classified error in err,
+// or an empty kind if nothing classified it.
+func KindOf(err error) Kind {
+	var k Kind
+	if As(err, &k) {
+		return k
+	}
+	return ""
+}
+
+// Status returns the HTTP status code which fits the kind of err.
+// Unclassified errors are internal errors.
+func Status(err error) int {
+	switch KindOf(err) {
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Invalid:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
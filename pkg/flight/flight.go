@@ -0,0 +1,121 @@
+// Package flight coalesces identical calls made at the same time, so a
+// burst of requests for the same thing only goes once to the database.
+package flight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats tells how many calls were coalesced since the Group was made
+type Stats struct {
+	// Calls are the calls which ran their function
+	Calls uint64 `json:"calls"`
+	// Coalesced are the calls which waited for an identical one instead
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// CoalescedRate is the fraction of the calls which shared another's result
+func (s Stats) CoalescedRate() float64 {
+	if s.Calls+s.Coalesced == 0 {
+		return 0
+	}
+	return float64(s.Coalesced) / float64(s.Calls+s.Coalesced)
+}
+
+type call struct {
+	done chan struct{}
+	v    interface{}
+	err  error
+}
+
+// DefaultTimeout limits the calls of the Groups with no Timeout
+const DefaultTimeout = 30 * time.Second
+
+// Group runs one call for each key at a time. The zero value is ready to
+// use and it is safe to use from many goroutines.
+type Group struct {
+	// Timeout limits each call, which goes on when its callers give up
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	calls     map[string]*call
+	ran       uint64
+	coalesced uint64
+}
+
+// Do runs fn, unless there is a call for key running already, in which case
+// it waits for it and returns its result. The result is shared by every
+// caller, so they must not change it. shared tells if it was.
+//
+// fn runs with the values of the context of the first caller, like its
+// trace, but not with its deadline or cancellation: the first caller going
+// away must not fail the others. A caller whose ctx is done stops waiting,
+// without stopping the call, which is limited by the Timeout of g instead.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c, shared := g.calls[key]
+	if shared {
+		atomic.AddUint64(&g.coalesced, 1)
+	} else {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+		atomic.AddUint64(&g.ran, 1)
+		go g.run(ctx, key, c, fn)
+	}
+	g.mu.Unlock()
+	select {
+	case <-c.done:
+		return c.v, shared, c.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+// run runs the call c of key, then lets its callers know
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer func() {
+		// nobody would recover it out of this goroutine
+		if p := recover(); p != nil {
+			c.v, c.err = nil, fmt.Errorf("flight: the call of %s panicked: %v", key, p)
+		}
+		cancel()
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.v, c.err = fn(ctx)
+}
+
+// Forget makes the next calls for the keys run again instead of waiting for
+// the ones running, whose results may be older than a write made meanwhile.
+// The callers already waiting still get them.
+func (g *Group) Forget(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range keys {
+		delete(g.calls, k)
+	}
+}
+
+// Stats returns how many calls were coalesced
+func (g *Group) Stats() Stats {
+	return Stats{
+		Calls:     atomic.LoadUint64(&g.ran),
+		Coalesced: atomic.LoadUint64(&g.coalesced),
+	}
+}
@@ -0,0 +1,143 @@
+package flight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	runs := 0
+	fn := func(context.Context) (interface{}, error) {
+		runs++
+		close(started)
+		<-release
+		return "song", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	shared := make([]bool, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], shared[0], _ = g.Do(ctx, "k", fn)
+	}()
+	<-started
+	for i := 1; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], shared[i], _ = g.Do(ctx, "k", fn)
+		}(i)
+	}
+	// every other call has to be waiting before the first one ends
+	for g.Stats().Coalesced < 4 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if runs != 1 {
+		t.Errorf("expected the function to run once, ran %d times", runs)
+	}
+	for i, v := range results {
+		if v != "song" || shared[i] != (i > 0) {
+			t.Errorf("call %d: expected the shared result, got %v (shared %v)", i, v, shared[i])
+		}
+	}
+	if s := g.Stats(); s != (Stats{Calls: 1, Coalesced: 4}) || s.CoalescedRate() != 0.8 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// once it is done, the next call runs again
+	if _, sh, err := g.Do(ctx, "k", func(context.Context) (interface{}, error) { return nil, nil }); sh || err != nil {
+		t.Errorf("expected a new call, got shared %v: %v", sh, err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	ctx := context.Background()
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan interface{})
+	go func() {
+		v, _, _ := g.Do(ctx, "k", func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "old", nil
+		})
+		done <- v
+	}()
+	<-started
+	g.Forget("k")
+	v, shared, err := g.Do(ctx, "k", func(context.Context) (interface{}, error) { return "new", nil })
+	if v != "new" || shared || err != nil {
+		t.Errorf("expected a new call once forgotten, got %v (shared %v): %v", v, shared, err)
+	}
+	close(release)
+	if v := <-done; v != "old" {
+		t.Errorf("expected the first call to get its own result, got %v", v)
+	}
+}
+
+// TestLeaderCancelled cancels the first caller while another one waits,
+// which must still get the result
+func TestLeaderCancelled(t *testing.T) {
+	var g Group
+	leader, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "trace"))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil || ctx.Value(key{}) != "trace" {
+			return nil, errors.New("expected the values but not the cancellation of the first caller")
+		}
+		return "song", nil
+	}
+	errs := make(chan error)
+	go func() {
+		_, _, err := g.Do(leader, "k", fn)
+		errs <- err
+	}()
+	<-started
+	waiter := make(chan interface{})
+	go func() {
+		v, _, err := g.Do(context.Background(), "k", fn)
+		if err != nil {
+			v = err
+		}
+		waiter <- v
+	}()
+	for g.Stats().Coalesced < 1 {
+		runtime.Gosched()
+	}
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected the first caller to give up, got: %v", err)
+	}
+	close(release)
+	if v := <-waiter; v != "song" {
+		t.Errorf("expected the waiting caller to get the result, got: %v", v)
+	}
+
+	g.Timeout = time.Millisecond
+	_, _, err := g.Do(context.Background(), "slow", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the call to time out, got: %v", err)
+	}
+}
+
+type key struct{}
@@ -0,0 +1,90 @@
+package gin
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+// UserKey is where authentication middlewares should store the user of the
+// request in the gin context, so the access log can print it.
+const UserKey = "user"
+
+// UseAccessLog will print one structured log per request handled by the engine.
+// Successful requests are only printed sampleRate of the times (0 to 1),
+// while requests which failed are always printed.
+func (e *Engine) UseAccessLog(log logs.Printer, sampleRate float64) {
+	e.gin.Use(accessLog(log, sampleRate))
+}
+
+// UseAccessLog will print one structured log per request handled by the group.
+// See Engine.UseAccessLog.
+func (r *RouterGroup) UseAccessLog(log logs.Printer, sampleRate float64) {
+	r.gin.Use(accessLog(log, sampleRate))
+}
+
+func accessLog(log logs.Printer, sampleRate float64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := requestID(c)
+		defer func() {
+			p := recover()
+			status := c.Writer.Status()
+			if p != nil {
+				// gin.Recovery, which runs before us, answers the panic with a 500
+				status = http.StatusInternalServerError
+			}
+			logRequest(log, c, start, id, status, sampleRate)
+			if p != nil {
+				panic(p)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// logRequest prints the request of c, which ended with status
+func logRequest(log logs.Printer, c *gin.Context, start time.Time, id string, status int, sampleRate float64) {
+	if status < 400 && !sampled(sampleRate) {
+		return
+	}
+	size := c.Writer.Size()
+	if size < 0 {
+		size = 0
+	}
+	fields := logs.I{
+		"method":    c.Request.Method,
+		"route":     route(c),
+		"path":      c.Request.URL.Path,
+		"status":    status,
+		"latencyMs": float64(time.Since(start)) / float64(time.Millisecond),
+		"bytes":     size,
+		"clientIp":  c.ClientIP(),
+		"requestId": id,
+	}
+	if span := trace.FromContext(c.Request.Context()); span != nil {
+		fields["traceId"] = span.Context().TraceID.String()
+	}
+	if user, ok := c.Get(UserKey); ok {
+		fields["user"] = user
+	}
+	if status < 400 {
+		fields["sampleRate"] = sampleRate
+	}
+	switch {
+	case status >= 500:
+		log.Error("Request", fields)
+	case status >= 400:
+		log.Warn("Request", fields)
+	default:
+		log.Info("Request", fields)
+	}
+}
+
+func sampled(rate float64) bool {
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
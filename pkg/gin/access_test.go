@@ -0,0 +1,50 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestAccessLog(t *testing.T) {
+	SetTest()
+	log := logstest.New()
+	e := New("8080")
+	e.UseAccessLog(log, 0)
+	e.GET("/songs", func(c *Context) (int, interface{}, error) {
+		return 200, []string{"song"}, nil
+	})
+	e.GET("/songs/:name", func(c *Context) (int, interface{}, error) {
+		return 404, nil, errors.New("song not found")
+	})
+	e.GET("/panic", func(c *Context) (int, interface{}, error) {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/songs", "/songs/x", "/panic"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if _, ok := log.Find("info", "Request"); ok {
+		t.Errorf("expected successful requests not to be logged with a sample rate of 0")
+	}
+	if r, ok := log.Find("warn", "Request"); !ok || r.Fields["status"] != 404 || r.Fields["route"] != "/songs/:name" {
+		t.Errorf("expected the failed request to be logged, got %+v", r)
+	}
+	if r, ok := log.Find("error", "Request"); !ok || r.Fields["status"] != 500 || r.Fields["path"] != "/panic" {
+		t.Errorf("expected the panic to be logged as a 500, got %+v", r)
+	}
+
+	log = logstest.New()
+	e = New("8080")
+	e.UseAccessLog(log, 1)
+	e.GET("/songs", func(c *Context) (int, interface{}, error) {
+		return 200, []string{"song"}, nil
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/songs", nil))
+	if r, ok := log.Find("info", "Request"); !ok || r.Fields["status"] != http.StatusOK || r.Fields["sampleRate"] != 1.0 {
+		t.Errorf("expected every successful request to be logged with a sample rate of 1, got %+v", r)
+	}
+}
@@ -0,0 +1,47 @@
+package gin
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// UseBodyLog will print the body of every request at debug level, with
+// every sensitive field masked. Only the first maxBytes of each body are printed.
+// It is meant for debugging, don't turn it on in production.
+func (e *Engine) UseBodyLog(log logs.Printer, maxBytes int) {
+	e.gin.Use(bodyLog(log, maxBytes))
+}
+
+func bodyLog(log logs.Printer, maxBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+		head, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, int64(maxBytes)))
+		// give the controllers the whole body back, what we read and what is left
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+		if err != nil {
+			log.Warn("Could not read request body", logs.I{"error": err.Error(), "requestId": requestID(c)})
+			c.Next()
+			return
+		}
+		log.Debug("Request body", logs.I{
+			"method":    c.Request.Method,
+			"path":      c.Request.URL.Path,
+			"requestId": requestID(c),
+			"body":      logs.Redact().JSON(head),
+			"truncated": int64(len(head)) < c.Request.ContentLength || c.Request.ContentLength < 0,
+		})
+		c.Next()
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
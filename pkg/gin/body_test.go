@@ -0,0 +1,34 @@
+package gin
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestBodyLog(t *testing.T) {
+	SetTest()
+	log := logstest.New()
+	e := New("8080")
+	e.UseBodyLog(log, 32)
+	var got string
+	e.POST("/login", func(c *Context) (int, interface{}, error) {
+		b, err := ioutil.ReadAll(c.Request.Body)
+		got = string(b)
+		return 200, "ok", err
+	})
+
+	body := `{"user":"admin","password":"hunter2","bio":"` + strings.Repeat("a", 64) + `"}`
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", strings.NewReader(body)))
+	if got != body {
+		t.Errorf("expected the controller to get the whole body, got %s", got)
+	}
+	r, ok := log.Find("debug", "Request body")
+	logged, _ := r.Fields["body"].(string)
+	if !ok || r.Fields["truncated"] != true || strings.Contains(logged, "hunter2") || !strings.Contains(logged, `"user":"admin"`) {
+		t.Errorf("expected the start of the body with the password masked, got %+v", r)
+	}
+}
@@ -0,0 +1,63 @@
+package gin
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS holds the origins allowed to call the API from a browser.
+// They can be changed while the engine is running.
+type CORS struct {
+	origins atomic.Value
+}
+
+// NewCORS returns a CORS allowing origins. Use * to allow any origin.
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins
+func (c *CORS) SetOrigins(origins []string) {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.TrimSuffix(o, "/")] = true
+	}
+	c.origins.Store(allowed)
+}
+
+func (c *CORS) allowed(origin string) bool {
+	allowed := c.origins.Load().(map[string]bool)
+	return allowed["*"] || allowed[origin]
+}
+
+// UseCORS will answer preflight requests and add the CORS headers to
+// the responses for the origins allowed by c.
+func (e *Engine) UseCORS(c *CORS) {
+	e.gin.Use(func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+		ctx.Header("Vary", "Origin")
+		if !c.allowed(origin) {
+			ctx.Next()
+			return
+		}
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		ctx.Header("Access-Control-Expose-Headers", RequestIDHeader+", traceparent")
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			ctx.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			ctx.Header("Access-Control-Allow-Headers", "Content-Type, "+RequestIDHeader+", traceparent")
+			ctx.Header("Access-Control-Max-Age", "600")
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		ctx.Next()
+	})
+}
@@ -0,0 +1,42 @@
+package gin
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	SetTest()
+	cors := NewCORS([]string{"https://music.com/"})
+	e := New("8080")
+	e.UseCORS(cors)
+	e.GET("/songs", func(c *Context) (int, interface{}, error) { return 200, []string{}, nil })
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/songs", nil)
+		req.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+	w := request("GET", "https://music.com")
+	if w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != "https://music.com" {
+		t.Errorf("expected the origin to be allowed, got %d: %v", w.Code, w.Header())
+	}
+	w = request("OPTIONS", "https://music.com")
+	if w.Code != 204 || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("expected the preflight to be answered, got %d: %v", w.Code, w.Header())
+	}
+	w = request("GET", "https://evil.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected the origin not to be allowed, got %v", w.Header())
+	}
+
+	cors.SetOrigins([]string{"*"})
+	if w = request("GET", "https://evil.com"); w.Header().Get("Access-Control-Allow-Origin") != "https://evil.com" {
+		t.Errorf("expected every origin to be allowed, got %v", w.Header())
+	}
+}
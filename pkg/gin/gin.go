@@ -1,11 +1,14 @@
 package gin
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pclavier92/go-restful-api/pkg/errors"
 	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
 )
 
 // Controller is a function which takes a context and returns an status code,
@@ -19,6 +22,14 @@ type HandlerFunc = gin.HandlerFunc
 type Context struct {
 	*gin.Context
 	ID string
+	// maxAge is how long clients and proxies may keep the response
+	maxAge time.Duration
+}
+
+// CacheFor lets clients and proxies keep a successful response for d.
+// Errors are never cached.
+func (c *Context) CacheFor(d time.Duration) {
+	c.maxAge = d
 }
 
 // SetTest will activate gin's test mode
@@ -30,6 +41,7 @@ func SetTest() {
 type Engine struct {
 	gin  *gin.Engine
 	port string
+	spec *spec
 }
 
 // New returns a new engine for you to use as you please
@@ -39,7 +51,7 @@ func New(port string) *Engine {
 	g.GET("/ping", func(c *gin.Context) {
 		c.String(200, "pong")
 	})
-	return &Engine{g, port}
+	return &Engine{g, port, &spec{}}
 }
 
 // Static will serve static content
@@ -48,6 +60,8 @@ func (e *Engine) Static(path, location string) {
 }
 
 // UseLogger will activate the default gin logger for this engine
+//
+// Deprecated: it prints plain text outside of our logs. Use UseAccessLog.
 func (e *Engine) UseLogger() {
 	e.gin.Use(gin.Logger())
 }
@@ -59,31 +73,39 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 // Group returns a RouterGroup so you can organize paths
 func (e *Engine) Group(prefix string) *RouterGroup {
-	return &RouterGroup{e.gin.Group(prefix)}
+	return &RouterGroup{e.gin.Group(prefix), e.spec}
 }
 
-// GET registers a path to go to a controller
-func (e *Engine) GET(path string, fn Controller) {
+// GET registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (e *Engine) GET(path string, fn Controller, doc ...Doc) {
+	e.spec.add("GET", e.gin.BasePath(), path, doc)
 	e.gin.GET(path, adapt(fn))
 }
 
-// PATCH registers a path to go to a controller
-func (e *Engine) PATCH(path string, fn Controller) {
+// PATCH registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (e *Engine) PATCH(path string, fn Controller, doc ...Doc) {
+	e.spec.add("PATCH", e.gin.BasePath(), path, doc)
 	e.gin.PATCH(path, adapt(fn))
 }
 
-// POST registers a path to go to a controller
-func (e *Engine) POST(path string, fn Controller) {
+// POST registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (e *Engine) POST(path string, fn Controller, doc ...Doc) {
+	e.spec.add("POST", e.gin.BasePath(), path, doc)
 	e.gin.POST(path, adapt(fn))
 }
 
-// PUT registers a path to go to a controller
-func (e *Engine) PUT(path string, fn Controller) {
+// PUT registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (e *Engine) PUT(path string, fn Controller, doc ...Doc) {
+	e.spec.add("PUT", e.gin.BasePath(), path, doc)
 	e.gin.PUT(path, adapt(fn))
 }
 
-// Any registers a path to go to a controller with any method
-func (e *Engine) Any(path string, fn Controller) {
+// Any registers a path to go to a controller with any method. It may take a
+// Doc for the OpenAPI spec, which documents it for every method.
+func (e *Engine) Any(path string, fn Controller, doc ...Doc) {
+	for _, m := range anyMethods {
+		e.spec.add(m, e.gin.BasePath(), path, doc)
+	}
 	e.gin.Any(path, adapt(fn))
 }
 
@@ -94,42 +116,50 @@ func (e *Engine) Run() error {
 
 // RouterGroup is a simple router where we can organize paths
 type RouterGroup struct {
-	gin *gin.RouterGroup
+	gin  *gin.RouterGroup
+	spec *spec
 }
 
-// UseLogger will activate the default gin logger for this engine
+// UseLogger will activate the default gin logger for this group
+//
+// Deprecated: it prints plain text outside of our logs. Use UseAccessLog.
 func (r *RouterGroup) UseLogger() {
 	r.gin.Use(gin.Logger())
 }
 
-// GET registers a path to go to a controller
-func (r *RouterGroup) GET(path string, fn Controller) {
+// GET registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (r *RouterGroup) GET(path string, fn Controller, doc ...Doc) {
+	r.spec.add("GET", r.gin.BasePath(), path, doc)
 	r.gin.GET(path, adapt(fn))
 }
 
-// POST registers a path to go to a controller
-func (r *RouterGroup) POST(path string, fn Controller) {
+// POST registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (r *RouterGroup) POST(path string, fn Controller, doc ...Doc) {
+	r.spec.add("POST", r.gin.BasePath(), path, doc)
 	r.gin.POST(path, adapt(fn))
 }
 
-// PUT registers a path to go to a controller
-func (r *RouterGroup) PUT(path string, fn Controller) {
+// PUT registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (r *RouterGroup) PUT(path string, fn Controller, doc ...Doc) {
+	r.spec.add("PUT", r.gin.BasePath(), path, doc)
 	r.gin.PUT(path, adapt(fn))
 }
 
-// PATCH registers a path to go to a controller
-func (r *RouterGroup) PATCH(path string, fn Controller) {
+// PATCH registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (r *RouterGroup) PATCH(path string, fn Controller, doc ...Doc) {
+	r.spec.add("PATCH", r.gin.BasePath(), path, doc)
 	r.gin.PATCH(path, adapt(fn))
 }
 
-// DELETE registers a path to go to a controller
-func (r *RouterGroup) DELETE(path string, fn Controller) {
+// DELETE registers a path to go to a controller. It may take a Doc for the OpenAPI spec
+func (r *RouterGroup) DELETE(path string, fn Controller, doc ...Doc) {
+	r.spec.add("DELETE", r.gin.BasePath(), path, doc)
 	r.gin.DELETE(path, adapt(fn))
 }
 
 // Group can create subgroups in a RouterGroup
 func (r *RouterGroup) Group(prefix string) *RouterGroup {
-	return &RouterGroup{r.gin.Group(prefix)}
+	return &RouterGroup{r.gin.Group(prefix), r.spec}
 }
 
 // StatusJSON is used to communicate statuses to the user
@@ -152,27 +182,30 @@ func MakeStatus(id, status string) StatusJSON {
 
 // adapt converts from a function taking a context and returning
 // an status and a json or a string or an apiErr.
-// it will also set a random id to the context
+// errors are sent as application/problem+json bodies.
+// it will also set the request id to the context
 func adapt(cr Controller) gin.HandlerFunc {
-	type error struct {
-		Error string `json:"error"`
-	}
 	return func(c *gin.Context) {
-		// TODO: make some id random
-		cc := Context{c, "someID"}
+		cc := Context{Context: c, ID: requestID(c)}
 		code, ctx, err := cr(&cc)
 		if err != nil {
+			trace.FromContext(c.Request.Context()).SetError(err)
+			p := MakeProblem(&cc, code, err)
 			if e, ok := err.(*errors.Chain); ok {
-				e.Pkg.Log.Info("Error in API", logs.I{
-					"error":    err.Error(),
-					"external": e.External,
-					"code":     code,
+				logf := e.Pkg.Log.Error
+				if code < 500 {
+					logf = e.Pkg.Log.Warn
+				}
+				logf("Error in API", logs.I{
+					"error":     e.Report(),
+					"external":  e.External,
+					"code":      code,
+					"requestId": cc.ID,
 				})
-				e := error{e.External}
-				c.JSON(code, e)
-				return
 			}
-			c.JSON(code, error{"unkonwn error :("})
+			c.Header("Content-Type", ProblemContentType)
+			c.Header("Cache-Control", "no-store")
+			c.JSON(code, p)
 			return
 		}
 		if code == 302 {
@@ -183,6 +216,9 @@ func adapt(cr Controller) gin.HandlerFunc {
 		if str, ok := ctx.(string); ok {
 			ctx = MakeStatus(str, "ok")
 		}
+		if cc.maxAge > 0 {
+			c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cc.maxAge/time.Second)))
+		}
 		c.JSON(code, ctx)
 	}
 }
@@ -0,0 +1,314 @@
+package gin
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+// Doc describes a route for the generated OpenAPI spec.
+// Pass it as the last argument when registering a route.
+type Doc struct {
+	// Summary is a one line explanation of what the route does
+	Summary string
+	// Description can explain the route in more detail
+	Description string
+	// Tags group routes in the docs UI. Defaults to the first path segment.
+	Tags []string
+	// Request is a value of the type expected as JSON body, like api.Song{}
+	Request interface{}
+	// Responses are the possible status codes with a value of the type
+	// returned for each one. Use nil for responses without a body. Errors
+	// (status >= 400) are always documented as problem+json.
+	Responses Responses
+}
+
+// Responses maps a status code to a value of the type returned with it
+type Responses map[int]interface{}
+
+// spec collects every documented route of an engine
+type spec struct {
+	mu     sync.Mutex
+	routes []endpoint
+}
+
+// anyMethods are the methods documented for the routes of Any, the ones
+// which gin takes and OpenAPI knows about
+var anyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS", "TRACE"}
+
+type endpoint struct {
+	method string
+	path   string
+	doc    Doc
+}
+
+func (s *spec) add(method, base, path string, docs []Doc) {
+	path = strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	d := Doc{}
+	if len(docs) > 0 {
+		d = docs[0]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, endpoint{method, path, d})
+}
+
+// ServeDocs will expose the OpenAPI spec of every route registered on
+// the engine in /openapi.json, and an interactive UI to browse it in /docs.
+// The UI is served from the binary, so it works offline and runs no
+// third-party scripts.
+func (e *Engine) ServeDocs(title, version string) {
+	e.gin.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, e.spec.build(title, version))
+	})
+	e.gin.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+	})
+	e.gin.StaticFS("/docs/assets", swaggerFiles.HTTP)
+}
+
+// OpenAPI returns the spec for the routes registered so far
+func (e *Engine) OpenAPI(title, version string) map[string]interface{} {
+	return e.spec.build(title, version)
+}
+
+type object = map[string]interface{}
+
+func (s *spec) build(title, version string) object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schemas := object{"Problem": problemSchema()}
+	paths := object{}
+	for _, r := range s.routes {
+		path, params := openAPIPath(r.path)
+		item, ok := paths[path].(object)
+		if !ok {
+			item = object{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.method)] = s.operation(r, params, schemas)
+	}
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+		},
+	}
+}
+
+func (s *spec) operation(r endpoint, params []string, schemas object) object {
+	op := object{
+		"operationId": operationID(r.method, r.path),
+		"tags":        r.doc.Tags,
+	}
+	if len(r.doc.Tags) == 0 {
+		op["tags"] = []string{firstSegment(r.path)}
+	}
+	if r.doc.Summary != "" {
+		op["summary"] = r.doc.Summary
+	}
+	if r.doc.Description != "" {
+		op["description"] = r.doc.Description
+	}
+	if len(params) > 0 {
+		var ps []object
+		for _, p := range params {
+			ps = append(ps, object{
+				"name":     p,
+				"in":       "path",
+				"required": true,
+				"schema":   object{"type": "string"},
+			})
+		}
+		op["parameters"] = ps
+	}
+	if r.doc.Request != nil {
+		op["requestBody"] = object{
+			"required": true,
+			"content": object{
+				"application/json": object{"schema": schemaFor(reflect.TypeOf(r.doc.Request), schemas)},
+			},
+		}
+	}
+	responses := object{}
+	codes := make([]int, 0, len(r.doc.Responses))
+	for code := range r.doc.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		res := object{"description": http.StatusText(code)}
+		if code >= 400 {
+			res["content"] = object{
+				ProblemContentType: object{"schema": object{"$ref": "#/components/schemas/Problem"}},
+			}
+		} else if v := r.doc.Responses[code]; v != nil {
+			res["content"] = object{
+				"application/json": object{"schema": schemaFor(reflect.TypeOf(v), schemas)},
+			}
+		}
+		responses[strconv.Itoa(code)] = res
+	}
+	responses["default"] = object{
+		"description": "Unexpected error",
+		"content": object{
+			ProblemContentType: object{"schema": object{"$ref": "#/components/schemas/Problem"}},
+		},
+	}
+	op["responses"] = responses
+	return op
+}
+
+// problemSchema documents the problem+json sent by adapt when a controller fails
+func problemSchema() object {
+	str := object{"type": "string"}
+	return object{
+		"type": "object",
+		"properties": object{
+			"type":      str,
+			"title":     str,
+			"status":    object{"type": "integer"},
+			"detail":    str,
+			"instance":  str,
+			"code":      str,
+			"requestId": str,
+			"errors": object{
+				"type": "array",
+				"items": object{
+					"type": "object",
+					"properties": object{
+						"field":   str,
+						"message": str,
+					},
+				},
+			},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema of a go type. Named structs are
+// added to schemas and referenced, so they show up as models in the UI.
+func schemaFor(t reflect.Type, schemas object) object {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// reserve the name first so recursive types don't loop forever
+			schemas[t.Name()] = object{}
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return object{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return object{}
+}
+
+func structSchema(t reflect.Type, schemas object) object {
+	props := object{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		props[name] = schemaFor(f.Type, schemas)
+	}
+	return object{"type": "object", "properties": props}
+}
+
+// openAPIPath converts a gin path like /songs/:name into /songs/{name}
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.Split(path, "/") {
+		s = strings.TrimLeft(s, ":*")
+		if s == "" {
+			continue
+		}
+		id += strings.ToUpper(s[:1]) + s[1:]
+	}
+	return id
+}
+
+func firstSegment(path string) string {
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			return s
+		}
+	}
+	return "default"
+}
+
+// docsPage loads swagger-ui 4.15.5, from github.com/swaggo/files v1.0.1
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>API docs</title>
+  <link rel="stylesheet" href="/docs/assets/swagger-ui.css">
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="/docs/assets/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: "/openapi.json", dom_id: "#docs"});
+  </script>
+</body>
+</html>
+`
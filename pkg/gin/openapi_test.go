@@ -0,0 +1,82 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+type docSong struct {
+	Name     string   `json:"name"`
+	Duration int      `json:"duration,omitempty"`
+	Artist   *docSong `json:"artist"`
+	Tags     []string `json:"tags"`
+	secret   string
+}
+
+func TestOpenAPI(t *testing.T) {
+	SetTest()
+	e := New("8080")
+	get := func(c *Context) (int, interface{}, error) { return 200, docSong{}, nil }
+	e.Group("/songs").GET("/:name", get, Doc{
+		Summary:   "Get a song",
+		Responses: Responses{200: docSong{}, 404: nil},
+	})
+	e.Any("/anything", get, Doc{Summary: "Anything"})
+	e.ServeDocs("music", "1.0")
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc struct {
+		Info  map[string]string
+		Paths map[string]map[string]struct {
+			OperationID string
+			Summary     string
+			Tags        []string
+			Parameters  []map[string]interface{}
+			Responses   map[string]struct {
+				Content map[string]struct{ Schema map[string]interface{} }
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unexpected error: %v, body: %s", err, w.Body)
+	}
+	if doc.Info["title"] != "music" || doc.Info["version"] != "1.0" {
+		t.Errorf("wrong info %+v", doc.Info)
+	}
+	op, ok := doc.Paths["/songs/{name}"]["get"]
+	if !ok || op.OperationID != "getSongsName" || op.Summary != "Get a song" || len(op.Tags) != 1 || op.Tags[0] != "songs" {
+		t.Fatalf("expected the route to be documented, got %+v", doc.Paths)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0]["name"] != "name" || op.Parameters[0]["in"] != "path" {
+		t.Errorf("expected the name parameter, got %+v", op.Parameters)
+	}
+	if ref := op.Responses["200"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/docSong" {
+		t.Errorf("expected the song to be referenced, got %v", ref)
+	}
+	if ref := op.Responses["404"].Content[ProblemContentType].Schema["$ref"]; ref != "#/components/schemas/Problem" {
+		t.Errorf("expected errors to be problems, got %v", ref)
+	}
+	props := doc.Components.Schemas["docSong"].Properties
+	if len(props) != 4 || props["name"]["type"] != "string" || props["duration"]["type"] != "integer" ||
+		props["artist"]["$ref"] != "#/components/schemas/docSong" || props["tags"]["type"] != "array" {
+		t.Errorf("expected the exported fields of the song by their json names, got %+v", props)
+	}
+	if n := len(doc.Paths["/anything"]); n != len(anyMethods) {
+		t.Errorf("expected the route of Any to be documented for every method, got %d", n)
+	}
+
+	for _, path := range []string{"/docs", "/docs/assets/swagger-ui-bundle.js", "/docs/assets/swagger-ui.css"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 || w.Body.Len() == 0 {
+			t.Errorf("expected %s to be served, got %d", path, w.Code)
+		}
+	}
+}
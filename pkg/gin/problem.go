@@ -0,0 +1,80 @@
+package gin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+)
+
+// ProblemContentType is the media type of the error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// RequestIDHeader is the header where we read and write the id of each request
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "requestID"
+
+// Problem is the body sent to the user when a controller fails
+type Problem struct {
+	// Type is a URI reference identifying the problem, made from Code
+	Type string `json:"type"`
+	// Title is a short summary of the problem, the text of the status code
+	Title string `json:"title"`
+	// Status is the HTTP status code
+	Status int `json:"status"`
+	// Detail is the explanation of this specific occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request which failed
+	Instance string `json:"instance"`
+	// Code is a stable identifier of the problem the frontend can switch on
+	Code string `json:"code"`
+	// RequestID lets us find the logs of the request which failed
+	RequestID string `json:"requestId"`
+	// Errors tells which fields of the request were invalid, if any
+	Errors []errors.FieldError `json:"errors,omitempty"`
+}
+
+// MakeProblem returns the Problem for an error returned by a controller
+func MakeProblem(c *Context, status int, err error) Problem {
+	p := Problem{
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    "unknown error",
+		Instance:  c.Request.URL.Path,
+		Code:      errors.CodeUnknown,
+		RequestID: c.ID,
+	}
+	if e, ok := err.(*errors.Chain); ok {
+		p.Detail = e.External
+		p.Errors = e.Fields
+		if e.Code != "" {
+			p.Code = e.Code
+		}
+	}
+	p.Type = "/problems/" + p.Code
+	return p
+}
+
+// requestID returns the id of the request, which is taken from the request
+// headers if the client sent one or generated otherwise.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+	id := c.GetHeader(RequestIDHeader)
+	if id == "" || len(id) > 64 {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
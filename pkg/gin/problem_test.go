@@ -0,0 +1,65 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestProblem(t *testing.T) {
+	SetTest()
+	fn := errors.Pkg("gin", logstest.New()).Struct("test").Fn("TestProblem")
+	e := New("8080")
+	e.POST("/songs", func(c *Context) (int, interface{}, error) {
+		return 400, nil, fn.InvalidFields("no name", errors.FieldError{Field: "name", Message: "is required"})
+	})
+	e.GET("/songs", func(c *Context) (int, interface{}, error) {
+		return 500, nil, errors.New("connection refused")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/songs", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	e.ServeHTTP(w, req)
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Problem{
+		Type:      "/problems/" + errors.CodeInvalidData,
+		Title:     "Bad Request",
+		Status:    400,
+		Detail:    "invalid data sent",
+		Instance:  "/songs",
+		Code:      errors.CodeInvalidData,
+		RequestID: "abc",
+		Errors:    []errors.FieldError{{Field: "name", Message: "is required"}},
+	}
+	if w.Code != 400 || !reflect.DeepEqual(p, want) {
+		t.Errorf("wrong problem, got %d: %+v, wanted: %+v", w.Code, p, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("expected a problem+json, got %s", ct)
+	}
+	if id := w.Header().Get(RequestIDHeader); id != "abc" {
+		t.Errorf("expected the id of the client back, got %q", id)
+	}
+
+	// errors which are not chains tell nothing to the user
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/songs", nil))
+	p = Problem{}
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Code != 500 || p.Code != errors.CodeUnknown || p.Detail != "unknown error" {
+		t.Errorf("expected an unknown error, got %d: %+v", w.Code, p)
+	}
+	if id := w.Header().Get(RequestIDHeader); len(id) != 32 || p.RequestID != id {
+		t.Errorf("expected a new request id in the header and the problem, got %q and %q", id, p.RequestID)
+	}
+}
@@ -0,0 +1,54 @@
+package gin
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+// UseTracer will create a server span for every request handled by the engine.
+// If the request comes with a traceparent header the span joins that trace,
+// and the response will always carry the traceparent of the server span.
+func (e *Engine) UseTracer(t *trace.Tracer) {
+	e.gin.Use(tracing(t))
+}
+
+func tracing(t *trace.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Request.Method + " " + route(c)
+		ctx := c.Request.Context()
+		var span *trace.Span
+		if parent, ok := trace.Parse(c.GetHeader(trace.Header)); ok {
+			ctx, span = t.StartRemote(ctx, name, trace.KindServer, parent)
+		} else {
+			ctx, span = t.Start(ctx, name, trace.KindServer)
+		}
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(trace.Header, trace.Format(span.Context()))
+		span.SetAttr("http.method", c.Request.Method).
+			SetAttr("http.route", route(c)).
+			SetAttr("http.target", c.Request.URL.Path)
+
+		c.Next()
+
+		span.SetAttr("http.status_code", c.Writer.Status())
+		if len(c.Errors) > 0 {
+			span.SetError(c.Errors.Last())
+		}
+	}
+}
+
+// route returns the path template of the request, falling back to the raw path
+func route(c *gin.Context) string {
+	if r := c.FullPath(); r != "" {
+		return r
+	}
+	return c.Request.URL.Path
+}
+
+// Ctx returns the context of the request, which carries the current span
+func (c *Context) Ctx() context.Context {
+	return c.Request.Context()
+}
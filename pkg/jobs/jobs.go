@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+// Func is the work done by a job
+type Func func(ctx context.Context) error
+
+// Locker makes sure only one replica runs a job at a time.
+// TryLock returns false, and no error, when someone else holds the lock.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// LocalLocker only locks jobs inside this process, good for tests and
+// for running a single replica.
+type LocalLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+// TryLock takes the lock called name if nobody in this process holds it
+func (l *LocalLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = map[string]bool{}
+	}
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+	}, true, nil
+}
+
+// ErrLocked is returned when a job is already running somewhere else
+var ErrLocked = errors.New("job is already running")
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       Func
+}
+
+// Runner holds every job of the app. Jobs are registered at startup, then run
+// once with Run, like in job mode, or on their schedules with Start.
+type Runner struct {
+	mu     sync.Mutex
+	jobs   map[string]job
+	locker Locker
+	tracer *trace.Tracer
+	log    logs.Printer
+	err    errors.Structer
+}
+
+// New returns a runner which takes the lock of a job from locker before running it
+func New(locker Locker, log logs.Printer) *Runner {
+	return &Runner{
+		jobs:   map[string]job{},
+		locker: locker,
+		log:    log,
+		err:    errors.Pkg("jobs", log).Struct("Runner"),
+	}
+}
+
+// UseTracer makes every run of a job the root of a trace, unless the
+// context given to Run already carries a span.
+func (r *Runner) UseTracer(t *trace.Tracer) {
+	r.tracer = t
+}
+
+// Register adds a job called name. An empty schedule means the job only runs
+// when asked to, see ParseSchedule for the rest.
+func (r *Runner) Register(name, schedule string, fn Func) error {
+	e := r.err.Fn("Register").Tag("job", name)
+	var s Schedule
+	if schedule != "" {
+		var err error
+		if s, err = ParseSchedule(schedule); err != nil {
+			return e.Wrap(err, "invalid schedule")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jobs[name]; ok {
+		return e.New("job already registered")
+	}
+	r.jobs[name] = job{name, s, fn}
+	return nil
+}
+
+// Names returns the names of every registered job, sorted
+func (r *Runner) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.jobs))
+	for n := range r.jobs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs the job called name once, if no one else is running it.
+// It returns ErrLocked, wrapped, when the job is running somewhere else.
+func (r *Runner) Run(ctx context.Context, name string) error {
+	e := r.err.Fn("Run").Tag("job", name)
+	r.mu.Lock()
+	j, ok := r.jobs[name]
+	r.mu.Unlock()
+	if !ok {
+		return e.NotFound()
+	}
+	return e.Wrap(r.run(ctx, j), "running job")
+}
+
+func (r *Runner) run(ctx context.Context, j job) (err error) {
+	var span *trace.Span
+	if r.tracer != nil {
+		ctx, span = r.tracer.Start(ctx, "jobs."+j.name, trace.KindInternal)
+	} else {
+		ctx, span = trace.Start(ctx, "jobs."+j.name)
+	}
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	log := r.log.With(logs.I{"job": j.name})
+	unlock, ok, err := r.locker.TryLock(ctx, "job."+j.name)
+	if err != nil {
+		log.Error("Could not lock job", logs.I{"error": err.Error()})
+		return err
+	}
+	if !ok {
+		return ErrLocked
+	}
+	defer unlock()
+	start := time.Now()
+	log.Info("Job started", nil)
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New("job panicked")
+			log.Error("Job panicked", logs.I{"panic": p})
+		}
+	}()
+	if err := j.fn(ctx); err != nil {
+		log.Error("Job failed", logs.I{"error": err.Error(), "durationMs": time.Since(start).Milliseconds()})
+		return err
+	}
+	log.Info("Job finished", logs.I{"durationMs": time.Since(start).Milliseconds()})
+	return nil
+}
+
+// Start runs every scheduled job on its schedule until stop is closed.
+// A job never overlaps with itself, and a run is skipped when another
+// replica holds its lock.
+func (r *Runner) Start(stop <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, j := range r.jobs {
+		if j.schedule != nil {
+			go r.loop(j, stop)
+		}
+	}
+}
+
+func (r *Runner) loop(j job, stop <-chan struct{}) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			r.log.Warn("Job will never run again", logs.I{"job": j.name})
+			return
+		}
+		timer := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		// failures are logged by run, there is nothing else to do until the next time
+		if err := r.run(context.Background(), j); err == ErrLocked {
+			r.log.Debug("Job skipped, it is running somewhere else", logs.I{"job": j.name})
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/errors"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2020, time.March, 2, 10, 7, 30, 0, time.UTC) // a Monday
+	cases := map[string]time.Time{
+		"@every 90m":    from.Add(90 * time.Minute),
+		"* * * * *":     time.Date(2020, time.March, 2, 10, 8, 0, 0, time.UTC),
+		"*/15 * * * *":  time.Date(2020, time.March, 2, 10, 15, 0, 0, time.UTC),
+		"0 4 * * *":     time.Date(2020, time.March, 3, 4, 0, 0, 0, time.UTC),
+		"30 9 1,15 * *": time.Date(2020, time.March, 15, 9, 30, 0, 0, time.UTC),
+		"0 0 * * 6":     time.Date(2020, time.March, 7, 0, 0, 0, 0, time.UTC),
+	}
+	for expr, want := range cases {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(want) {
+			t.Errorf("%q: expected %v, got %v", expr, want, got)
+		}
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "@every -1s"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRunLocks(t *testing.T) {
+	log := logstest.New()
+	locker := &LocalLocker{}
+	r := New(locker, log)
+	ran := 0
+	if err := r.Register("stats", "", func(ctx context.Context) error { ran++; return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Register("stats", "", nil); err == nil {
+		t.Errorf("expected an error registering a job twice")
+	}
+	if err := r.Run(context.Background(), "stats"); err != nil || ran != 1 {
+		t.Fatalf("expected the job to run, got: %v", err)
+	}
+	unlock, _, _ := locker.TryLock(context.Background(), "job.stats")
+	if err := r.Run(context.Background(), "stats"); !errors.Is(err, ErrLocked) || ran != 1 {
+		t.Errorf("expected the job to be locked, got: %v", err)
+	}
+	unlock()
+	if err := r.Run(context.Background(), "nope"); !errors.Is(err, errors.NotFound) {
+		t.Errorf("expected unknown jobs to be not found, got: %v", err)
+	}
+	if _, ok := log.Find("info", "Job finished"); !ok {
+		t.Errorf("expected the run to be logged, got: %v", log.Entries())
+	}
+}
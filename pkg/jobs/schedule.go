@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job has to run next
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// every runs a job at a fixed interval
+type every time.Duration
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cron runs a job on the minutes matching its fields
+type cron struct {
+	minute, hour, dom, month, dow map[int]bool
+}
+
+// maxLookAhead is how far we look for the next run of a cron schedule
+const maxLookAhead = 5 * 366 * 24 * time.Hour
+
+func (c cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for end := t.Add(maxLookAhead); t.Before(end); t = t.Add(time.Minute) {
+		if c.month[int(t.Month())] && c.dom[t.Day()] && c.dow[int(t.Weekday())] &&
+			c.hour[t.Hour()] && c.minute[t.Minute()] {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ParseSchedule reads a schedule, either "@every <duration>", like
+// "@every 1h30m", or a cron expression with five fields: minute, hour,
+// day of month, month and day of week. Fields take *, numbers, ranges
+// like 1-5, lists like 1,15 and steps like */10. A minute matches when
+// every field matches it, day of month and day of week included.
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(s, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", s, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: duration must be positive", s)
+		}
+		return every(d), nil
+	}
+	f := strings.Fields(s)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, got %d", s, len(f))
+	}
+	var c cron
+	var err error
+	bounds := []struct {
+		field    *map[int]bool
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 6}}
+	for i, b := range bounds {
+		if *b.field, err = parseField(f[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", s, err)
+		}
+	}
+	return c, nil
+}
+
+// parseField returns the values between min and max matched by a cron field
+func parseField(s string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
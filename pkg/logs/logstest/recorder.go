@@ -0,0 +1,92 @@
+package logstest
+
+import (
+	"sync"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// Entry is a single log printed to a Recorder
+type Entry struct {
+	Level  string
+	Title  string
+	Fields logs.I
+}
+
+// Recorder is a logs.Printer which keeps everything it prints,
+// so tests can assert on the logs of the code they run.
+type Recorder struct {
+	store  *store
+	fields logs.I
+}
+
+type store struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// New returns an empty recorder
+func New() *Recorder {
+	return &Recorder{&store{}, logs.I{}}
+}
+
+func (r *Recorder) record(level, title string, args logs.I) {
+	fields := make(logs.I, len(r.fields)+len(args))
+	for k, v := range r.fields {
+		fields[k] = v
+	}
+	for k, v := range args {
+		fields[k] = v
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = append(r.store.entries, Entry{level, title, fields})
+}
+
+// Info records an info log
+func (r *Recorder) Info(title string, args logs.I) { r.record("info", title, args) }
+
+// Debug records a debug log
+func (r *Recorder) Debug(title string, args logs.I) { r.record("debug", title, args) }
+
+// Warn records a warning log
+func (r *Recorder) Warn(title string, args logs.I) { r.record("warn", title, args) }
+
+// Error records an error log
+func (r *Recorder) Error(title string, args logs.I) { r.record("error", title, args) }
+
+// With returns a child recorder which shares the entries with its parent
+func (r *Recorder) With(args logs.I) logs.Printer {
+	fields := make(logs.I, len(r.fields)+len(args))
+	for k, v := range r.fields {
+		fields[k] = v
+	}
+	for k, v := range args {
+		fields[k] = v
+	}
+	return &Recorder{r.store, fields}
+}
+
+// Entries returns a copy of everything recorded so far
+func (r *Recorder) Entries() []Entry {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return append([]Entry(nil), r.store.entries...)
+}
+
+// Find returns the first entry with the level and title, and if there was one
+func (r *Recorder) Find(level, title string) (Entry, bool) {
+	for _, e := range r.Entries() {
+		if e.Level == level && e.Title == title {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Reset forgets every entry recorded so far
+func (r *Recorder) Reset() {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = nil
+}
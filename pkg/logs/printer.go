@@ -1,23 +1,63 @@
 package logs
 
 import (
+	"io"
 	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 type log struct {
-	log *logrus.Logger
+	log    *logrus.Logger
+	fields logrus.Fields
+}
+
+// entry masks every sensitive field before handing them to logrus
+func (l log) entry(args I) *logrus.Entry {
+	r := Redact()
+	e := l.log.WithFields(logrus.Fields(r.Fields(l.fields)))
+	if len(args) > 0 {
+		e = e.WithFields(logrus.Fields(r.Fields(args)))
+	}
+	return e
 }
 
 func (l log) Info(title string, args I) {
-	fields := logrus.Fields(args)
-	l.log.WithFields(fields).Info(title)
+	l.entry(args).Info(title)
 }
 
 func (l log) Debug(title string, args I) {
-	fields := logrus.Fields(args)
-	l.log.WithFields(fields).Debug(title)
+	l.entry(args).Debug(title)
+}
+
+func (l log) Warn(title string, args I) {
+	l.entry(args).Warn(title)
+}
+
+func (l log) Error(title string, args I) {
+	l.entry(args).Error(title)
+}
+
+// SetLevel changes the level of the logger, and of every child made with With
+func (l log) SetLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.log.SetLevel(lvl)
+	return nil
+}
+
+func (l log) With(args I) Printer {
+	fields := make(logrus.Fields, len(l.fields)+len(args))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range args {
+		fields[k] = v
+	}
+	return log{l.log, fields}
 }
 
 // I is a simple alias for a map.
@@ -27,17 +67,85 @@ type I = map[string]interface{}
 type Printer interface {
 	Info(title string, args I)
 	Debug(title string, args I)
+	Warn(title string, args I)
+	Error(title string, args I)
+	// With returns a child logger which adds fields to everything it prints
+	With(args I) Printer
+}
+
+// Leveler is a logger whose level can be changed while it is being used
+type Leveler interface {
+	SetLevel(level string) error
+}
+
+// Config says how and where to print logs
+type Config struct {
+	// Level is one of debug, info, warn or error
+	Level string
+	// Format is either text or json
+	Format string
+	// Output is either stdout or file
+	Output string
+	// File is the path of the log file when Output is file
+	File string
+	// MaxSizeMB is the size at which the log file is rotated. 0 means never.
+	MaxSizeMB int
+	// MaxBackups is how many rotated files we keep around
+	MaxBackups int
+}
+
+// ScopeConfig returns the default config for a scope: text debug
+// logs for local and test, JSON info logs for everything else.
+func ScopeConfig(scope string) Config {
+	if scope == "test" || scope == "" || scope == "local" {
+		return Config{Level: "debug", Format: "text", Output: "stdout"}
+	}
+	return Config{Level: "info", Format: "json", Output: "stdout"}
 }
 
 // New returns a logger based on a scope
 func New(scope string) (Printer, error) {
+	return NewWithConfig(ScopeConfig(scope))
+}
+
+// NewWithConfig returns a logger configured by c
+func NewWithConfig(c Config) (Printer, error) {
 	l := logrus.New()
-	l.Out = os.Stdout
-	if scope == "test" || scope == "" || scope == "local" {
-		l.SetLevel(logrus.DebugLevel)
-	} else {
-		l.SetLevel(logrus.InfoLevel)
-		logrus.SetFormatter(&logrus.JSONFormatter{})
+	level, err := logrus.ParseLevel(c.Level)
+	if err != nil {
+		return nil, err
+	}
+	l.SetLevel(level)
+	switch strings.ToLower(c.Format) {
+	case "json":
+		l.SetFormatter(&logrus.JSONFormatter{})
+	case "text", "":
+		l.SetFormatter(&logrus.TextFormatter{})
+	default:
+		return nil, &ConfigError{"unknown log format " + c.Format}
+	}
+	var out io.Writer
+	switch strings.ToLower(c.Output) {
+	case "stdout", "":
+		out = os.Stdout
+	case "file":
+		if c.File == "" {
+			return nil, &ConfigError{"log output is file but no file was given"}
+		}
+		out, err = newRotatingFile(c.File, c.MaxSizeMB, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &ConfigError{"unknown log output " + c.Output}
 	}
-	return log{l}, nil
+	l.Out = out
+	return log{l, logrus.Fields{}}, nil
 }
+
+// ConfigError is returned when the logs config makes no sense
+type ConfigError struct {
+	msg string
+}
+
+func (e *ConfigError) Error() string { return e.msg }
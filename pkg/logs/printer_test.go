@@ -0,0 +1,162 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithAndLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "music.log")
+	l, err := NewWithConfig(Config{Level: "warn", Format: "json", Output: "file", File: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	child := l.With(I{"requestId": "abc"})
+	child.Info("ignored", nil)
+	child.Error("failed", I{"code": 500})
+	l.Warn("parent", nil)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines above the warn level, got: %d\n%s", len(lines), b)
+	}
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first["level"] != "error" || first["requestId"] != "abc" || first["code"] != float64(500) {
+		t.Errorf("child log is not what we expected, got: %v", first)
+	}
+	if _, ok := second["requestId"]; ok {
+		t.Errorf("expected the parent not to have the fields of the child, got: %v", second)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "music.log")
+	f, err := newRotatingFile(path, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1024*3+1; i++ {
+		if _, err := f.Write(line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s to exist: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := NewRedactor([]string{"dbPass"}, []string{`\d{4}-\d{4}-\d{4}-\d{4}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := r.Fields(I{
+		"Password": "hunter2",
+		"db_pass":  "root",
+		"name":     "card 1234-5678-9012-3456",
+		"headers":  map[string]interface{}{"Authorization": "Bearer abc.def"},
+		"note":     "sent Bearer abc.def",
+		"id":       1,
+	})
+	want := I{
+		"Password": Mask,
+		"db_pass":  Mask,
+		"name":     "card " + Mask,
+		"headers":  I{"Authorization": Mask},
+		"note":     "sent " + Mask,
+		"id":       1,
+	}
+	for k, v := range want {
+		if m, ok := v.(I); ok {
+			if gm, _ := got[k].(I); gm["Authorization"] != m["Authorization"] {
+				t.Errorf("wrong %s, got: %v, wanted: %v", k, got[k], v)
+			}
+			continue
+		}
+		if got[k] != v {
+			t.Errorf("wrong %s, got: %v, wanted: %v", k, got[k], v)
+		}
+	}
+	body := r.JSON([]byte(`{"username":"admin","password":"admin"}`))
+	if body != `{"password":"[REDACTED]","username":"admin"}` {
+		t.Errorf("wrong body, got: %s", body)
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	r, err := NewRedactor([]string{"dbPass"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for body, want := range map[string]string{
+		// cut in the middle, as the body log does past its limit
+		`{"name":"x","password":"hunter2","bio":"aaaa`:     `{"name":"x","password":"[REDACTED]","bio":"aaaa`,
+		`{"name":"x", "db_pass" : "hun`:                    `{"name":"x", "db_pass" : "[REDACTED]"`,
+		`{"token":12345,"tags":["a","b"],"note":"Bearer a`: `{"token":"[REDACTED]","tags":["a","b"],"note":"[REDACTED]`,
+		`user=a&password=hunter2`:                          `user=a&password=[REDACTED]`,
+		`api%5Fkey=abc&name=x%3Dy&Token=&secret=s`:         `api%5Fkey=[REDACTED]&name=x%3Dy&Token=[REDACTED]&secret=[REDACTED]`,
+	} {
+		if got := r.JSON([]byte(body)); got != want {
+			t.Errorf("wrong body for %s, got: %s, wanted: %s", body, got, want)
+		}
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	r, err := NewRedactor(nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	type login struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	}{
+		{http.Header{"Authorization": {"Basic YWRtaW4="}, "Accept": {"*/*"}}, `map[Accept:[*/*] Authorization:[REDACTED]]`},
+		{map[string]string{"password": "hunter2", "name": "x"}, `map[name:x password:[REDACTED]]`},
+		{login{"admin", "hunter2"}, `map[password:[REDACTED] user:admin]`},
+		{&login{"admin", "hunter2"}, `map[password:[REDACTED] user:admin]`},
+		{[]login{{"admin", "hunter2"}}, `[map[password:[REDACTED] user:admin]]`},
+		{[]string{"Bearer abc"}, `[[REDACTED]]`},
+		{[]byte("Bearer abc"), `[REDACTED]`},
+		{42, `42`},
+	} {
+		if got := fmt.Sprint(r.Value(c.v)); got != c.want {
+			t.Errorf("wrong value for %#v, got: %s, wanted: %s", c.v, got, c.want)
+		}
+	}
+}
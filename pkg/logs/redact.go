@@ -0,0 +1,214 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces every sensitive value
+const Mask = "[REDACTED]"
+
+// DefaultFields are the names of fields which are always masked
+var DefaultFields = []string{"password", "passwd", "secret", "token", "authorization", "apikey", "api_key", "cookie"}
+
+// DefaultPatterns match sensitive values wherever they show up in a string
+var DefaultPatterns = []string{
+	`(?i)bearer\s+[a-z0-9\-._~+/]+=*`,
+	`(?i)basic\s+[a-z0-9+/]+=*`,
+}
+
+// Redactor masks sensitive data, either by the name of the field which
+// holds it or by patterns matching the value itself.
+type Redactor struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a redactor masking the default fields and patterns
+// plus the ones given. Field names are case insensitive.
+func NewRedactor(fields, patterns []string) (*Redactor, error) {
+	r := &Redactor{fields: map[string]bool{}}
+	for _, f := range append(DefaultFields, fields...) {
+		r.fields[normalize(f)] = true
+	}
+	for _, p := range append(DefaultPatterns, patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// normalize makes Api-Key, api_key and APIKEY the same field
+func normalize(field string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(field))
+}
+
+// Sensitive tells you if a field with this name has to be masked
+func (r *Redactor) Sensitive(field string) bool {
+	return r.fields[normalize(field)]
+}
+
+// Field returns the value to print for a field: the mask if the field is
+// sensitive, or the value with every sensitive part of it masked.
+func (r *Redactor) Field(key string, v interface{}) interface{} {
+	if r.Sensitive(key) {
+		return Mask
+	}
+	return r.Value(v)
+}
+
+// Value masks the sensitive parts of v, going into maps with string keys,
+// like http.Header, slices, pointers and structs. Structs are printed as
+// their JSON, so their fields are named by their json tags.
+func (r *Redactor) Value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return r.String(t)
+	case map[string]interface{}:
+		return r.Fields(t)
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = r.Value(e)
+		}
+		return res
+	case error:
+		return r.String(t.Error())
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return r.String(rv.String())
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return v
+		}
+		return r.Value(rv.Elem().Interface())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		res := make(I, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			k := it.Key().String()
+			res[k] = r.Field(k, it.Value().Interface())
+		}
+		return res
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.Kind() == reflect.Slice {
+				return r.String(string(rv.Bytes()))
+			}
+			break
+		}
+		res := make([]interface{}, rv.Len())
+		for i := range res {
+			res[i] = r.Value(rv.Index(i).Interface())
+		}
+		return res
+	case reflect.Struct:
+		// a struct which can't be printed as JSON could hide anything
+		b, err := json.Marshal(v)
+		if err != nil {
+			return Mask
+		}
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return Mask
+		}
+		return r.Value(doc)
+	}
+	return v
+}
+
+// Fields returns a copy of fields with every sensitive value masked
+func (r *Redactor) Fields(fields I) I {
+	res := make(I, len(fields))
+	for k, v := range fields {
+		res[k] = r.Field(k, v)
+	}
+	return res
+}
+
+// String masks every part of s matching a sensitive pattern
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+// JSON masks a JSON document, like the body of a request. If body is not
+// JSON, like a form or a document cut in the middle, it goes to Text.
+func (r *Redactor) JSON(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return r.Text(string(body))
+	}
+	b, err := json.Marshal(r.Value(v))
+	if err != nil {
+		return Mask
+	}
+	return string(b)
+}
+
+var (
+	// jsonPair matches "field": value, where the value may be cut short
+	jsonPair = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,}\]]*)`)
+	// formPair matches field=value, as in a form or a query string
+	formPair = regexp.MustCompile(`(^|[&;\s])([^=&;\s"]+)=([^&;\s"]*)`)
+)
+
+// Text masks a document which could not be parsed: the values of the
+// sensitive fields in its "field": value and field=value pairs, then every
+// part of it matching a sensitive pattern.
+func (r *Redactor) Text(s string) string {
+	s = jsonPair.ReplaceAllStringFunc(s, func(pair string) string {
+		m := jsonPair.FindStringSubmatch(pair)
+		if !r.Sensitive(m[1]) {
+			return pair
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + Mask + `"`
+	})
+	s = formPair.ReplaceAllStringFunc(s, func(pair string) string {
+		m := formPair.FindStringSubmatch(pair)
+		key, err := url.QueryUnescape(m[2])
+		if err != nil {
+			key = m[2]
+		}
+		if !r.Sensitive(key) {
+			return pair
+		}
+		return m[1] + m[2] + "=" + Mask
+	})
+	return r.String(s)
+}
+
+var redactor atomic.Value
+
+func init() {
+	r, err := NewRedactor(nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	redactor.Store(r)
+}
+
+// SetRedactor changes the redactor used by every logger and error chain
+func SetRedactor(r *Redactor) {
+	redactor.Store(r)
+}
+
+// Redact returns the redactor in use
+func Redact() *Redactor {
+	return redactor.Load().(*Redactor)
+}
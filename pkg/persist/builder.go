@@ -0,0 +1,386 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Pred is a condition of a WHERE clause. Values always go as arguments,
+// never inside the SQL, and columns are quoted.
+type Pred struct {
+	build func(d Dialect) (string, []interface{})
+}
+
+func compare(col, op string, v interface{}) Pred {
+	return Pred{func(d Dialect) (string, []interface{}) {
+		return d.Quote(col) + " " + op + " ?", []interface{}{v}
+	}}
+}
+
+// Eq is col = v
+func Eq(col string, v interface{}) Pred { return compare(col, "=", v) }
+
+// Ne is col <> v
+func Ne(col string, v interface{}) Pred { return compare(col, "<>", v) }
+
+// Lt is col < v
+func Lt(col string, v interface{}) Pred { return compare(col, "<", v) }
+
+// Le is col <= v
+func Le(col string, v interface{}) Pred { return compare(col, "<=", v) }
+
+// Gt is col > v
+func Gt(col string, v interface{}) Pred { return compare(col, ">", v) }
+
+// Ge is col >= v
+func Ge(col string, v interface{}) Pred { return compare(col, ">=", v) }
+
+// Like is col LIKE pattern
+func Like(col string, pattern string) Pred { return compare(col, "LIKE", pattern) }
+
+// IsNull is col IS NULL
+func IsNull(col string) Pred {
+	return Pred{func(d Dialect) (string, []interface{}) {
+		return d.Quote(col) + " IS NULL", nil
+	}}
+}
+
+// In is col IN (vs...). With no values it is always false.
+func In(col string, vs ...interface{}) Pred {
+	return Pred{func(d Dialect) (string, []interface{}) {
+		if len(vs) == 0 {
+			return "1 = 0", nil
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(vs)), ", ")
+		return d.Quote(col) + " IN (" + marks + ")", vs
+	}}
+}
+
+// And is true when every p is. With no p it is always true.
+func And(ps ...Pred) Pred { return join(" AND ", "1 = 1", ps) }
+
+// Or is true when any p is. With no p it is always false.
+func Or(ps ...Pred) Pred { return join(" OR ", "1 = 0", ps) }
+
+// Not is true when p is false
+func Not(p Pred) Pred {
+	return Pred{func(d Dialect) (string, []interface{}) {
+		s, args := p.build(d)
+		return "NOT (" + s + ")", args
+	}}
+}
+
+func join(op, empty string, ps []Pred) Pred {
+	if len(ps) == 1 {
+		return ps[0]
+	}
+	return Pred{func(d Dialect) (string, []interface{}) {
+		if len(ps) == 0 {
+			return empty, nil
+		}
+		var parts []string
+		var args []interface{}
+		for _, p := range ps {
+			s, a := p.build(d)
+			parts = append(parts, "("+s+")")
+			args = append(args, a...)
+		}
+		return strings.Join(parts, op), args
+	}}
+}
+
+// where builds the WHERE clause, if there is one
+func where(d Dialect, p *Pred) (string, []interface{}) {
+	if p == nil {
+		return "", nil
+	}
+	s, args := p.build(d)
+	return " WHERE " + s, args
+}
+
+// quoteAll quotes every column, but *
+func quoteAll(d Dialect, cols []string) string {
+	q := make([]string, len(cols))
+	for i, c := range cols {
+		q[i] = c
+		if c != "*" {
+			q[i] = d.Quote(c)
+		}
+	}
+	return strings.Join(q, ", ")
+}
+
+type order struct {
+	col  string
+	desc bool
+}
+
+// SelectQuery builds a SELECT. It is immutable, every method returns a copy.
+type SelectQuery struct {
+	cols   []string
+	table  string
+	where  *Pred
+	orders []order
+	limit  int
+	offset int
+}
+
+// Select starts a SELECT of cols, or of every column if there are none
+func Select(cols ...string) SelectQuery {
+	if len(cols) == 0 {
+		cols = []string{"*"}
+	}
+	return SelectQuery{cols: cols}
+}
+
+// From sets the table
+func (q SelectQuery) From(table string) SelectQuery {
+	q.table = table
+	return q
+}
+
+// Where sets the condition, joining every p with AND
+func (q SelectQuery) Where(ps ...Pred) SelectQuery {
+	p := And(ps...)
+	q.where = &p
+	return q
+}
+
+// OrderBy adds col to the ordering, ascending
+func (q SelectQuery) OrderBy(col string) SelectQuery {
+	q.orders = append(append([]order{}, q.orders...), order{col, false})
+	return q
+}
+
+// OrderByDesc adds col to the ordering, descending
+func (q SelectQuery) OrderByDesc(col string) SelectQuery {
+	q.orders = append(append([]order{}, q.orders...), order{col, true})
+	return q
+}
+
+// Limit returns at most n rows
+func (q SelectQuery) Limit(n int) SelectQuery {
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows, it needs a Limit
+func (q SelectQuery) Offset(n int) SelectQuery {
+	q.offset = n
+	return q
+}
+
+// Build returns the SQL, with ? placeholders, and its arguments
+func (q SelectQuery) Build(d Dialect) (string, []interface{}) {
+	sql := fmt.Sprintf("SELECT %s FROM %s", quoteAll(d, q.cols), d.Quote(q.table))
+	w, args := where(d, q.where)
+	sql += w
+	if len(q.orders) > 0 {
+		var o []string
+		for _, ord := range q.orders {
+			s := d.Quote(ord.col)
+			if ord.desc {
+				s += " DESC"
+			}
+			o = append(o, s)
+		}
+		sql += " ORDER BY " + strings.Join(o, ", ")
+	}
+	if q.limit > 0 {
+		sql += " " + d.Limit(q.limit, q.offset)
+	}
+	return sql, args
+}
+
+// InsertQuery builds an INSERT. It is immutable, every method returns a copy.
+type InsertQuery struct {
+	table string
+	cols  []string
+	rows  [][]interface{}
+	// keys of the upsert, if it is one
+	keys []string
+}
+
+// Insert starts an INSERT into table
+func Insert(table string) InsertQuery {
+	return InsertQuery{table: table}
+}
+
+// Columns sets the columns the values are for
+func (q InsertQuery) Columns(cols ...string) InsertQuery {
+	q.cols = cols
+	return q
+}
+
+// Values adds a row, with a value for each column
+func (q InsertQuery) Values(vs ...interface{}) InsertQuery {
+	return q.Rows(vs)
+}
+
+// Rows adds many rows at once, which is cheaper than calling Values for each
+func (q InsertQuery) Rows(rows ...[]interface{}) InsertQuery {
+	all := make([][]interface{}, 0, len(q.rows)+len(rows))
+	q.rows = append(append(all, q.rows...), rows...)
+	return q
+}
+
+// OnConflictUpdate turns the insert into an upsert: the rows whose keys,
+// which need a unique index, are taken update every other column instead
+func (q InsertQuery) OnConflictUpdate(keys ...string) InsertQuery {
+	q.keys = keys
+	return q
+}
+
+// Build returns the SQL, with ? placeholders, and its arguments
+func (q InsertQuery) Build(d Dialect) (string, []interface{}) {
+	marks := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(q.cols)), ", ") + ")"
+	values := make([]string, len(q.rows))
+	var args []interface{}
+	for i, r := range q.rows {
+		values[i] = marks
+		args = append(args, r...)
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", d.Quote(q.table), quoteAll(d, q.cols), strings.Join(values, ", "))
+	if len(q.keys) > 0 {
+		cols := make([]string, len(q.cols))
+		for i, c := range q.cols {
+			cols[i] = d.Quote(c)
+		}
+		keys := make([]string, len(q.keys))
+		for i, k := range q.keys {
+			keys[i] = d.Quote(k)
+		}
+		sql += " " + d.OnConflict(cols, keys)
+	}
+	return sql, args
+}
+
+// maxArgs is the most arguments we send in a statement. MySQL and
+// PostgreSQL take up to 65535, and SQLite 32766.
+const maxArgs = 32766
+
+// Batches splits q in inserts of at most rows rows each, and at least one
+func (q InsertQuery) Batches(rows int) []InsertQuery {
+	if rows < 1 {
+		rows = 1
+	}
+	var batches []InsertQuery
+	for start := 0; start < len(q.rows); start += rows {
+		end := start + rows
+		if end > len(q.rows) {
+			end = len(q.rows)
+		}
+		b := q
+		b.rows = q.rows[start:end:end]
+		batches = append(batches, b)
+	}
+	return batches
+}
+
+// batchRows is how many rows of q fit in a statement. It is at least one,
+// so rows with too many columns fail in the database instead of never
+// being sent.
+func (q InsertQuery) batchRows() int {
+	if len(q.cols) == 0 {
+		return maxArgs
+	}
+	if rows := maxArgs / len(q.cols); rows > 0 {
+		return rows
+	}
+	return 1
+}
+
+// Statements tells how many statements ExecInsert runs for q. A single one
+// inserts every row or none, more need a transaction to do so.
+func (q InsertQuery) Statements() int {
+	rows := q.batchRows()
+	return (len(q.rows) + rows - 1) / rows
+}
+
+// ExecInsert runs the insert, in as few statements as the databases let us,
+// returning how many rows it affected, as the database counts them: MySQL
+// counts two for each row an upsert updates. Run it in a transaction when the
+// rows must be inserted all or none and there are many Statements.
+func ExecInsert(ctx context.Context, e Executor, q InsertQuery) (int64, error) {
+	var total int64
+	for _, b := range q.Batches(q.batchRows()) {
+		query, args := b.Build(e.Dialect())
+		r, err := e.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+type assignment struct {
+	col string
+	v   interface{}
+}
+
+// UpdateQuery builds an UPDATE. It is immutable, every method returns a copy.
+type UpdateQuery struct {
+	table string
+	set   []assignment
+	where *Pred
+}
+
+// Update starts an UPDATE of table
+func Update(table string) UpdateQuery {
+	return UpdateQuery{table: table}
+}
+
+// Set changes col to v
+func (q UpdateQuery) Set(col string, v interface{}) UpdateQuery {
+	q.set = append(append([]assignment{}, q.set...), assignment{col, v})
+	return q
+}
+
+// Where sets the condition, joining every p with AND
+func (q UpdateQuery) Where(ps ...Pred) UpdateQuery {
+	p := And(ps...)
+	q.where = &p
+	return q
+}
+
+// Build returns the SQL, with ? placeholders, and its arguments
+func (q UpdateQuery) Build(d Dialect) (string, []interface{}) {
+	set := make([]string, len(q.set))
+	args := make([]interface{}, len(q.set))
+	for i, a := range q.set {
+		set[i] = d.Quote(a.col) + " = ?"
+		args[i] = a.v
+	}
+	w, wargs := where(d, q.where)
+	return fmt.Sprintf("UPDATE %s SET %s%s", d.Quote(q.table), strings.Join(set, ", "), w), append(args, wargs...)
+}
+
+// DeleteQuery builds a DELETE. It is immutable, every method returns a copy.
+type DeleteQuery struct {
+	table string
+	where *Pred
+}
+
+// Delete starts a DELETE from table. Without Where it deletes every row.
+func Delete(table string) DeleteQuery {
+	return DeleteQuery{table: table}
+}
+
+// Where sets the condition, joining every p with AND
+func (q DeleteQuery) Where(ps ...Pred) DeleteQuery {
+	p := And(ps...)
+	q.where = &p
+	return q
+}
+
+// Build returns the SQL, with ? placeholders, and its arguments
+func (q DeleteQuery) Build(d Dialect) (string, []interface{}) {
+	w, args := where(d, q.where)
+	return "DELETE FROM " + d.Quote(q.table) + w, args
+}
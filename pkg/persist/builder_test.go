@@ -0,0 +1,101 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/config"
+)
+
+func TestBuilder(t *testing.T) {
+	cases := []struct {
+		d Dialect
+		q interface {
+			Build(Dialect) (string, []interface{})
+		}
+		sql  string
+		args []interface{}
+	}{
+		{
+			mysqlDialect{},
+			Select("id", "name").From("Songs").Where(Eq("name", "x"), Or(Gt("id", 3), IsNull("duration"))).OrderByDesc("id").Limit(10).Offset(20),
+			"SELECT `id`, `name` FROM `Songs` WHERE (`name` = ?) AND ((`id` > ?) OR (`duration` IS NULL)) ORDER BY `id` DESC LIMIT 10 OFFSET 20",
+			[]interface{}{"x", 3},
+		},
+		{
+			postgresDialect{},
+			Select().From("Songs").Where(In("artist_id", 1, 2)),
+			`SELECT * FROM "songs" WHERE "artist_id" IN ($1, $2)`,
+			[]interface{}{1, 2},
+		},
+		{
+			sqliteDialect{},
+			Insert("Songs").Columns("name", "duration").Values("a", "1:00").Values("b", "2:00"),
+			`INSERT INTO "Songs" ("name", "duration") VALUES (?, ?), (?, ?)`,
+			[]interface{}{"a", "1:00", "b", "2:00"},
+		},
+		{
+			mysqlDialect{},
+			Insert("Songs").Columns("name", "duration").Values("a", "1:00").OnConflictUpdate("name"),
+			"INSERT INTO `Songs` (`name`, `duration`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `duration` = VALUES(`duration`)",
+			[]interface{}{"a", "1:00"},
+		},
+		{
+			postgresDialect{},
+			Insert("Songs").Columns("name", "duration").Values("a", "1:00").OnConflictUpdate("name"),
+			`INSERT INTO "songs" ("name", "duration") VALUES ($1, $2) ON CONFLICT ("name") DO UPDATE SET "duration" = excluded."duration"`,
+			[]interface{}{"a", "1:00"},
+		},
+		{
+			mysqlDialect{},
+			Update("Songs").Set("duration", "3:00").Where(Eq("name", "a")),
+			"UPDATE `Songs` SET `duration` = ? WHERE `name` = ?",
+			[]interface{}{"3:00", "a"},
+		},
+		{
+			mysqlDialect{},
+			Delete("Songs").Where(Eq("na`me", "a")),
+			"DELETE FROM `Songs` WHERE `na``me` = ?",
+			[]interface{}{"a"},
+		},
+	}
+	for _, c := range cases {
+		sql, args := c.q.Build(c.d)
+		if c.d.Name() == "postgres" {
+			sql = c.d.Rebind(sql)
+		}
+		if sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("expected %s %v, got %s %v", c.sql, c.args, sql, args)
+		}
+	}
+}
+
+func TestExecInsert(t *testing.T) {
+	c, _ := newTestConn(t, config.H{}, "CREATE TABLE Tracks (name VARCHAR(256) PRIMARY KEY, n INTEGER)")
+	ctx := context.Background()
+	rows := make([][]interface{}, maxArgs)
+	for i := range rows {
+		rows[i] = []interface{}{fmt.Sprint(i), i}
+	}
+	q := Insert("Tracks").Columns("name", "n").Rows(rows...)
+	if n := q.Statements(); n != 2 {
+		t.Errorf("expected 2 statements, got %d", n)
+	}
+	if n, err := ExecInsert(ctx, c, q); err != nil || n != maxArgs {
+		t.Fatalf("expected %d rows in batches, got %d: %v", maxArgs, n, err)
+	}
+	wide := Insert("Tracks").Columns(make([]string, maxArgs+1)...).Values(make([]interface{}, maxArgs+1)...).Values(make([]interface{}, maxArgs+1)...)
+	if n, b := wide.Statements(), wide.Batches(0); n != 2 || len(b) != 2 {
+		t.Errorf("expected a statement for each row too wide for one, got %d and %d batches", n, len(b))
+	}
+	q = Insert("Tracks").Columns("name", "n").Values("0", -1).Values("new", 1).OnConflictUpdate("name")
+	if _, err := ExecInsert(ctx, c, q); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var n, count int
+	if err := c.QueryRow("SELECT n, (SELECT COUNT(*) FROM Tracks) FROM Tracks WHERE name = ?", "0").Scan(&n, &count); err != nil || n != -1 || count != maxArgs+1 {
+		t.Errorf("expected the upsert to update one track and create another, got %d of %d: %v", n, count, err)
+	}
+}
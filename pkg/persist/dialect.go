@@ -0,0 +1,299 @@
+package persist
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pclavier92/go-restful-api/config"
+
+	// just importing the drivers for the side effects :)
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Dialect hides the differences between the databases we support.
+// Queries are always written with ? placeholders, and rebound by the
+// dialect before reaching the database.
+type Dialect interface {
+	// Name is the name of the dialect in the config: mysql, postgres or sqlite
+	Name() string
+	// Driver is the database/sql driver used to connect
+	Driver() string
+	// DSN is the data source name for the database in cfg
+	DSN(cfg config.H) string
+	// Rebind changes the ? placeholders of q to the ones of the dialect
+	Rebind(q string) string
+	// Quote quotes an identifier, like a table or a column, which may be qualified like Songs.name
+	Quote(name string) string
+	// Sanitize replaces the literals of q, keeping its quoted identifiers, see Sanitize
+	Sanitize(q string) string
+	// Limit returns the clause to get n rows skipping the first offset ones
+	Limit(n, offset int) string
+	// Upsert returns an insert of cols into table which updates every
+	// other column when a row with the same keys already exists
+	Upsert(table string, cols []string, keys []string) string
+	// OnConflict returns the clause which turns an insert of cols into an
+	// upsert, like Upsert. MySQL ignores the keys, it uses every unique key.
+	OnConflict(cols []string, keys []string) string
+}
+
+// DialectFor returns the dialect called name, MySQL if name is empty
+func DialectFor(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "mysql", "":
+		return mysqlDialect{}, nil
+	case "postgres", "postgresql":
+		return postgresDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", name)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string   { return "mysql" }
+func (mysqlDialect) Driver() string { return "mysql" }
+
+// DSN scans DATETIME columns into time.Time, and uses the TLS config
+// registered by New when there is a DBTLSCA to verify with
+func (mysqlDialect) DSN(cfg config.H) string {
+	c := mysql.NewConfig()
+	c.User = cfg.DBUser
+	c.Passwd = cfg.DBPass
+	c.Net = "tcp"
+	c.Addr = cfg.DBHost
+	c.DBName = cfg.DBName
+	c.ParseTime = true
+	c.Timeout = cfg.DBDialTimeout
+	c.ReadTimeout = cfg.DBReadTimeout
+	c.WriteTimeout = cfg.DBWriteTimeout
+	if cfg.DBCharset != "" {
+		c.Params = map[string]string{"charset": cfg.DBCharset}
+	}
+	if cfg.DBCollation != "" {
+		c.Collation = cfg.DBCollation
+	}
+	c.TLSConfig = cfg.DBTLS
+	if customTLS(cfg) {
+		c.TLSConfig = mysqlTLS
+	}
+	return c.FormatDSN()
+}
+
+func (mysqlDialect) Rebind(q string) string { return q }
+
+func (mysqlDialect) Quote(name string) string { return quote(name, "`") }
+
+func (mysqlDialect) Sanitize(q string) string { return sanitize(q, '`') }
+
+func (mysqlDialect) Limit(n, offset int) string { return limit(n, offset) }
+
+func (d mysqlDialect) Upsert(table string, cols []string, keys []string) string {
+	return insert(table, cols) + " " + d.OnConflict(cols, keys)
+}
+
+func (mysqlDialect) OnConflict(cols []string, keys []string) string {
+	var set []string
+	for _, c := range others(cols, keys) {
+		set = append(set, fmt.Sprintf("%s = VALUES(%s)", c, c))
+	}
+	if len(set) == 0 {
+		// nothing to update, but the insert must not fail either
+		set = append(set, fmt.Sprintf("%s = %s", keys[0], keys[0]))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
+
+// mysqlTLS is the name of the TLS config registered for DBTLSCA
+const mysqlTLS = "music"
+
+// customTLS tells if MySQL has to use the certificate authority in
+// cfg.DBTLSCA. Only when TLS is required: with preferred, or no TLS at
+// all, it would force a verified connection the config did not ask for.
+func customTLS(cfg config.H) bool {
+	return cfg.DBTLSCA != "" && (cfg.DBTLS == "true" || cfg.DBTLS == "skip-verify")
+}
+
+// registerTLS lets MySQL verify the database with the certificate authority
+// in cfg.DBTLSCA, see customTLS. PostgreSQL reads the file by itself.
+func registerTLS(cfg config.H, d Dialect) error {
+	if !customTLS(cfg) || d.Name() != "mysql" {
+		return nil
+	}
+	pem, err := os.ReadFile(cfg.DBTLSCA)
+	if err != nil {
+		return fmt.Errorf("reading dbTLSCA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates in dbTLSCA %s", cfg.DBTLSCA)
+	}
+	// the driver checks the certificate is for the host of each DSN
+	return mysql.RegisterTLSConfig(mysqlTLS, &tls.Config{
+		RootCAs: pool,
+		// skip-verify still encrypts, but trusts any certificate
+		InsecureSkipVerify: cfg.DBTLS == "skip-verify",
+	})
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string   { return "postgres" }
+func (postgresDialect) Driver() string { return "postgres" }
+
+// DSN maps DBTLS to the sslmode of libpq. PostgreSQL has no read nor write
+// timeouts, and the encoding of its connections is always UTF-8.
+func (postgresDialect) DSN(cfg config.H) string {
+	params := url.Values{}
+	switch cfg.DBTLS {
+	case "true":
+		params.Set("sslmode", "verify-full")
+	case "skip-verify":
+		params.Set("sslmode", "require")
+	case "preferred":
+		params.Set("sslmode", "prefer")
+	default:
+		params.Set("sslmode", "disable")
+	}
+	if cfg.DBTLSCA != "" {
+		params.Set("sslrootcert", cfg.DBTLSCA)
+	}
+	if cfg.DBDialTimeout > 0 {
+		// in whole seconds, and at least one, as 0 means forever
+		params.Set("connect_timeout", strconv.Itoa(int(math.Ceil(cfg.DBDialTimeout.Seconds()))))
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DBUser, cfg.DBPass),
+		Host:     cfg.DBHost,
+		Path:     "/" + cfg.DBName,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// Rebind numbers the placeholders, $1, $2..., skipping the ones in quotes
+func (postgresDialect) Rebind(q string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range q {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Quote lower cases the name first, as PostgreSQL does with the unquoted
+// names of our migrations and queries
+func (postgresDialect) Quote(name string) string { return quote(strings.ToLower(name), `"`) }
+
+func (postgresDialect) Sanitize(q string) string { return sanitize(q, '"') }
+
+func (postgresDialect) Limit(n, offset int) string { return limit(n, offset) }
+
+func (d postgresDialect) Upsert(table string, cols []string, keys []string) string {
+	return d.Rebind(insert(table, cols) + " " + onConflict(cols, keys))
+}
+
+func (postgresDialect) OnConflict(cols []string, keys []string) string { return onConflict(cols, keys) }
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string   { return "sqlite" }
+func (sqliteDialect) Driver() string { return "sqlite" }
+
+// DSN uses the database name as the path of the file, or :memory:.
+// Foreign keys are off by default on SQLite, so we turn them on.
+func (sqliteDialect) DSN(cfg config.H) string {
+	name := cfg.DBName
+	if name == ":memory:" {
+		// every connection of the pool has to see the same database
+		name = "file::memory:?cache=shared&"
+	} else {
+		name = "file:" + name + "?"
+	}
+	return name + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+func (sqliteDialect) Rebind(q string) string { return q }
+
+func (sqliteDialect) Quote(name string) string { return quote(name, `"`) }
+
+func (sqliteDialect) Sanitize(q string) string { return sanitize(q, '"') }
+
+func (sqliteDialect) Limit(n, offset int) string { return limit(n, offset) }
+
+func (sqliteDialect) Upsert(table string, cols []string, keys []string) string {
+	return insert(table, cols) + " " + onConflict(cols, keys)
+}
+
+func (sqliteDialect) OnConflict(cols []string, keys []string) string { return onConflict(cols, keys) }
+
+// quote quotes every part of name with q, doubling the q inside
+func quote(name, q string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = q + strings.Replace(p, q, q+q, -1) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+func limit(n, offset int) string {
+	if offset > 0 {
+		return fmt.Sprintf("LIMIT %d OFFSET %d", n, offset)
+	}
+	return fmt.Sprintf("LIMIT %d", n)
+}
+
+func insert(table string, cols []string) string {
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), marks)
+}
+
+// onConflict is the upsert clause of PostgreSQL and SQLite
+func onConflict(cols []string, keys []string) string {
+	var set []string
+	for _, c := range others(cols, keys) {
+		set = append(set, fmt.Sprintf("%s = excluded.%s", c, c))
+	}
+	action := "DO NOTHING"
+	if len(set) > 0 {
+		action = "DO UPDATE SET " + strings.Join(set, ", ")
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) %s", strings.Join(keys, ", "), action)
+}
+
+// others returns the cols which are not keys
+func others(cols []string, keys []string) []string {
+	var o []string
+	for _, c := range cols {
+		isKey := false
+		for _, k := range keys {
+			isKey = isKey || k == c
+		}
+		if !isKey {
+			o = append(o, c)
+		}
+	}
+	return o
+}
@@ -0,0 +1,144 @@
+package persist
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/migrations"
+)
+
+func TestRebind(t *testing.T) {
+	q := "SELECT * FROM Songs WHERE name = ? AND duration <> '?' AND artist_id = ?"
+	want := "SELECT * FROM Songs WHERE name = $1 AND duration <> '?' AND artist_id = $2"
+	if got := (postgresDialect{}).Rebind(q); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := (mysqlDialect{}).Rebind(q); got != q {
+		t.Errorf("expected mysql to keep the query, got %q", got)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	cols, keys := []string{"name", "duration"}, []string{"name"}
+	cases := map[string]string{
+		"mysql":    "INSERT INTO Songs (name, duration) VALUES (?, ?) ON DUPLICATE KEY UPDATE duration = VALUES(duration)",
+		"postgres": "INSERT INTO Songs (name, duration) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET duration = excluded.duration",
+		"sqlite":   "INSERT INTO Songs (name, duration) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET duration = excluded.duration",
+	}
+	for name, want := range cases {
+		d, err := DialectFor(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := d.Upsert("Songs", cols, keys); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+	if _, err := DialectFor("oracle"); err == nil {
+		t.Errorf("expected an error for an unknown driver")
+	}
+}
+
+// TestSQLite runs the migrations and the constraints on a real, in memory, database
+func TestSQLite(t *testing.T) {
+	c, _ := newTestConn(t, config.H{DBName: ":memory:", DBMaxOpenConns: 5, DBMaxIdleConns: 5})
+	fsys, err := migrations.For(c.Dialect().Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, err := NewMigrator(c, fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	if done, err := m.Up(ctx); err != nil || len(done) != 5 {
+		t.Fatalf("expected 5 migrations applied, got %d: %v", len(done), err)
+	}
+	if status, err := m.Status(ctx); err != nil || !status[2].Applied || status[2].AppliedAt.IsZero() {
+		t.Errorf("expected migration 3 to be applied, got %+v: %v", status, err)
+	}
+	if _, err := c.Exec("INSERT INTO Songs (name, duration, artist_id) VALUES (?, ?, ?)", "Song", "3:00", 42); !IsForeignKey(err) {
+		t.Errorf("expected a foreign key error, got: %v", err)
+	}
+	unlock, ok, err := c.TryLock(ctx, "test")
+	if err != nil || !ok {
+		t.Fatalf("expected to get the lock, got: %v", err)
+	}
+	if _, ok, _ := c.TryLock(ctx, "test"); ok {
+		t.Errorf("expected the lock to be taken")
+	}
+	unlock()
+
+	// the songs sharing a name are kept aside while their names are unique
+	if done, err := m.Down(ctx, 1); err != nil || len(done) != 1 {
+		t.Fatalf("expected 1 migration rolled back, got %d: %v", len(done), err)
+	}
+	for _, q := range []string{
+		"INSERT INTO Artists (name) VALUES ('Artist')",
+		"INSERT INTO Songs (name, duration, artist_id) VALUES ('Song', '3:00', 1), ('Song', '4:00', 1), ('Other', '1:00', 1)",
+	} {
+		if _, err := c.Exec(q); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	count := func() (n int) {
+		if err := c.QueryRow("SELECT COUNT(*) FROM Songs").Scan(&n); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return n
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 1 || count() != 2 {
+		t.Fatalf("expected the duplicate to be set aside, got %d songs: %v", count(), err)
+	}
+	if done, err := m.Down(ctx, 1); err != nil || len(done) != 1 || count() != 3 {
+		t.Fatalf("expected the duplicate to be back, got %d songs: %v", count(), err)
+	}
+	if _, err := c.Exec("DELETE FROM Songs"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 1 {
+		t.Fatalf("expected 1 migration applied, got %d: %v", len(done), err)
+	}
+
+	if done, err := m.Down(ctx, 5); err != nil || len(done) != 5 {
+		t.Fatalf("expected 5 migrations rolled back, got %d: %v", len(done), err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil || status[0].Applied {
+		t.Errorf("expected every migration to be pending, got %+v: %v", status, err)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	cfg := config.H{
+		DBUser:        "music",
+		DBPass:        "p@ss",
+		DBHost:        "db:3306",
+		DBName:        "Music",
+		DBDialTimeout: 1500 * time.Millisecond,
+		DBReadTimeout: 30 * time.Second,
+		DBCharset:     "utf8mb4",
+		DBCollation:   "utf8mb4_unicode_ci",
+		DBTLS:         "skip-verify",
+	}
+	want := "music:p@ss@tcp(db:3306)/Music?collation=utf8mb4_unicode_ci&parseTime=true&readTimeout=30s&timeout=1.5s&tls=skip-verify&charset=utf8mb4"
+	if got := (mysqlDialect{}).DSN(cfg); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	want = "postgres://music:p%40ss@db:3306/Music?connect_timeout=2&sslmode=require"
+	if got := (postgresDialect{}).DSN(cfg); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// a certificate authority only replaces TLS which is required
+	cfg = config.H{DBHost: "db:3306", DBTLSCA: "/etc/ca.pem"}
+	for tls, want := range map[string]string{"": "", "preferred": "&tls=preferred", "true": "&tls=" + mysqlTLS, "skip-verify": "&tls=" + mysqlTLS} {
+		cfg.DBTLS = tls
+		if dsn := (mysqlDialect{}).DSN(cfg); !strings.HasSuffix(dsn, "parseTime=true"+want) {
+			t.Errorf("DBTLS %q: expected the DSN to end with %q, got %q", tls, want, dsn)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package persist
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// MySQL error numbers we care about, see
+// https://dev.mysql.com/doc/refman/8.0/en/server-error-reference.html
+const (
+	errDupEntry        = 1062
+	errNoReferencedRow = 1452
+	errRowIsReferenced = 1451
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+	errUnknownStmt     = 1243
+	errNeedReprepare   = 1615
+)
+
+// PostgreSQL error codes we care about, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+	pgInvalidStmtName      = "26000"
+	pgFeatureNotSupported  = "0A000"
+)
+
+// SQLite extended result codes we care about, see
+// https://www.sqlite.org/rescode.html
+const (
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteSchema               = 17
+)
+
+// IsNoRows tells you if err says the query returned no rows
+func IsNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// IsDuplicate tells you if err was caused by breaking a unique constraint
+func IsDuplicate(err error) bool {
+	if mysqlNumber(err) == errDupEntry || pgCode(err) == pgUniqueViolation {
+		return true
+	}
+	n := sqliteCode(err)
+	return n == sqliteConstraintUnique || n == sqliteConstraintPrimaryKey
+}
+
+// IsForeignKey tells you if err was caused by breaking a foreign key constraint
+func IsForeignKey(err error) bool {
+	n := mysqlNumber(err)
+	return n == errNoReferencedRow || n == errRowIsReferenced ||
+		pgCode(err) == pgForeignKeyViolation || sqliteCode(err) == sqliteConstraintForeignKey
+}
+
+func mysqlNumber(err error) uint16 {
+	var e *mysql.MySQLError
+	if errors.As(err, &e) {
+		return e.Number
+	}
+	return 0
+}
+
+func pgCode(err error) string {
+	var e *pq.Error
+	if errors.As(err, &e) {
+		return string(e.Code)
+	}
+	return ""
+}
+
+func sqliteCode(err error) int {
+	var e *sqlite.Error
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return 0
+}
+
+// IsRetryable tells you if err was caused by a deadlock or a timeout waiting
+// for a lock, so running the transaction again may work
+func IsRetryable(err error) bool {
+	n := mysqlNumber(err)
+	code := pgCode(err)
+	// the extended SQLite codes keep the primary code in the lower byte
+	lite := sqliteCode(err) & 0xff
+	return n == errLockDeadlock || n == errLockWaitTimeout ||
+		code == pgSerializationFailure || code == pgDeadlockDetected ||
+		lite == sqliteBusy || lite == sqliteLocked
+}
+
+// isStale tells if err says a prepared statement can't be used anymore,
+// because its connection broke or the schema changed under it. PostgreSQL
+// says so with "cached plan must not change result type".
+func isStale(err error) bool {
+	n := mysqlNumber(err)
+	code := pgCode(err)
+	return isBadConn(err) ||
+		n == errUnknownStmt || n == errNeedReprepare ||
+		code == pgInvalidStmtName || code == pgFeatureNotSupported ||
+		sqliteCode(err)&0xff == sqliteSchema
+}
+
+// isBadConn tells if err says the connection to the database broke
+func isBadConn(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)
+}
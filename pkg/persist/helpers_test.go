@@ -0,0 +1,36 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+// newTestConn connects to a sqlite database of its own, with the pool and
+// the cache of cfg, and runs schema on it. The database is a file in a
+// temporary folder unless cfg names one, so the tests never see each
+// other's tables. The pool has a single connection unless cfg says otherwise.
+func newTestConn(t *testing.T, cfg config.H, schema ...string) (*Conn, *logstest.Recorder) {
+	t.Helper()
+	cfg.DBDriver = "sqlite"
+	if cfg.DBName == "" {
+		cfg.DBName = filepath.Join(t.TempDir(), "test.db")
+	}
+	if cfg.DBMaxOpenConns == 0 {
+		cfg.DBMaxOpenConns, cfg.DBMaxIdleConns = 1, 1
+	}
+	log := logstest.New()
+	c, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	for _, q := range schema {
+		if _, err := c.Exec(q); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return c, log
+}
@@ -0,0 +1,116 @@
+package persist
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// TryLock takes a named lock on the database, without waiting, so only one
+// replica of the app does something at a time. It returns false if someone
+// else holds the lock. The lock lives in its own connection, which goes back
+// to the pool when unlock is called.
+//
+// MySQL uses GET_LOCK and PostgreSQL advisory locks. SQLite has no such
+// thing, it is only used by a single process, so the lock is kept in memory.
+func (c *Conn) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	return c.Lock(ctx, name, 0)
+}
+
+// Lock is like TryLock, but waits up to wait, rounded to seconds, for
+// whoever holds the lock to release it.
+func (c *Conn) Lock(ctx context.Context, name string, wait time.Duration) (func(), bool, error) {
+	if c.dialect.Name() == "sqlite" {
+		return localLock(ctx, name, wait)
+	}
+	conn, err := c.sql.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var got bool
+	var release string
+	if c.dialect.Name() == "postgres" {
+		got, err = pgLock(ctx, conn, name, wait)
+		release = "SELECT pg_advisory_unlock(hashtext($1))"
+	} else {
+		got, err = mysqlLock(ctx, conn, name, wait)
+		release = "DO RELEASE_LOCK(?)"
+	}
+	if err != nil || !got {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		// the lock is released anyway if the connection dies
+		if _, err := conn.ExecContext(context.Background(), release, name); err != nil {
+			c.Log.Warn("Could not release lock", logs.I{"lock": name, "error": err.Error()})
+		}
+		conn.Close()
+	}, true, nil
+}
+
+func mysqlLock(ctx context.Context, conn *sql.Conn, name string, wait time.Duration) (bool, error) {
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(wait.Seconds())).Scan(&got); err != nil {
+		return false, err
+	}
+	if !got.Valid {
+		return false, errors.New("could not get lock " + name)
+	}
+	return got.Int64 == 1, nil
+}
+
+// pgLock polls for the lock, as advisory locks either fail right away or wait forever
+func pgLock(ctx context.Context, conn *sql.Conn, name string, wait time.Duration) (bool, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		var got bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&got); err != nil {
+			return false, err
+		}
+		if got || time.Now().After(deadline) {
+			return got, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+var local = struct {
+	sync.Mutex
+	held map[string]chan struct{}
+}{held: map[string]chan struct{}{}}
+
+func localLock(ctx context.Context, name string, wait time.Duration) (func(), bool, error) {
+	timeout := time.After(wait)
+	for {
+		local.Lock()
+		released, held := local.held[name]
+		if !held {
+			released = make(chan struct{})
+			local.held[name] = released
+			local.Unlock()
+			return func() {
+				local.Lock()
+				delete(local.held, name)
+				local.Unlock()
+				close(released)
+			}, true, nil
+		}
+		local.Unlock()
+		select {
+		case <-released:
+		case <-timeout:
+			return nil, false, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// Migration changes the schema of the database from one version to the next
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells if a migration was applied, and when
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// migrationFile is how migrations are named, like 0001_create_songs.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ReadMigrations reads every migration in fsys. Each version needs an up and
+// a down file, named like 0001_create_songs.up.sql and 0001_create_songs.down.sql.
+func ReadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, f := range files {
+		m := migrationFile.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is called both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	var migrations []Migration
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// statements splits a migration into its statements, which must end with a
+// semicolon at the end of a line
+func statements(sql string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		if t := strings.TrimSpace(line); t == "" || strings.HasPrefix(t, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// migrationsLock keeps two replicas from migrating at the same time
+const migrationsLock = "schema_migrations"
+
+// Migrator applies and rolls back migrations, remembering which ones were
+// applied in the schema_migrations table.
+type Migrator struct {
+	c          *Conn
+	migrations []Migration
+	// Wait is how long we wait for someone else to finish migrating
+	Wait time.Duration
+}
+
+// NewMigrator returns a migrator for the migrations in fsys
+func NewMigrator(c *Conn, fsys fs.FS) (*Migrator, error) {
+	migrations, err := ReadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{c, migrations, time.Minute}, nil
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.c.sql.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL PRIMARY KEY,
+  name VARCHAR(256) NOT NULL,
+  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	return err
+}
+
+// lock takes the migrations lock and creates schema_migrations if needed
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	unlock, ok, err := m.c.Lock(ctx, migrationsLock, m.Wait)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("someone else is migrating the database")
+	}
+	if err := m.init(ctx); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// Status tells which migrations were applied, oldest first
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+	return m.status(ctx)
+}
+
+func (m *Migrator) status(ctx context.Context) ([]MigrationStatus, error) {
+	rows, err := m.c.sql.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at timestamp
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at.Time
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		at, ok := applied[mig.Version]
+		status[i] = MigrationStatus{mig, ok, at}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration, in order, and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	status, err := m.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, s := range status {
+		if s.Applied {
+			continue
+		}
+		if err := m.apply(ctx, s.Migration, s.Up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", s.Version, s.Name); err != nil {
+			return done, err
+		}
+		m.c.Log.Info("Migration applied", logs.I{"version": s.Version, "name": s.Name})
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	status, err := m.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(status) - 1; i >= 0 && len(done) < steps; i-- {
+		s := status[i]
+		if !s.Applied {
+			continue
+		}
+		if err := m.apply(ctx, s.Migration, s.Down, "DELETE FROM schema_migrations WHERE version = ?", s.Version); err != nil {
+			return done, err
+		}
+		m.c.Log.Info("Migration rolled back", logs.I{"version": s.Version, "name": s.Name})
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// timestamp scans the times of every driver, some give us text instead of a time.Time
+type timestamp struct {
+	time.Time
+}
+
+func (t *timestamp) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("can't scan %T into a timestamp", v)
+}
+
+func (t *timestamp) parse(s string) error {
+	var err error
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t.Time, err = time.Parse(layout, s); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// apply runs the statements of a migration and then record, in a transaction.
+// Keep in mind MySQL commits DDL statements right away, so a migration failing
+// half way must be fixed by hand. Migrations are written for a single dialect,
+// so only record gets its placeholders rebound, by the Tx.
+func (m *Migrator) apply(ctx context.Context, mig Migration, sql string, record string, args ...interface{}) error {
+	return m.c.WithTxOptions(ctx, TxOptions{}, func(tx *Tx) error {
+		for _, stmt := range statements(sql) {
+			if _, err := tx.t.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d_%s: %v", mig.Version, mig.Name, err)
+			}
+		}
+		_, err := tx.ExecContext(ctx, record, args...)
+		return err
+	})
+}
@@ -0,0 +1,45 @@
+package persist
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/pclavier92/go-restful-api/migrations"
+)
+
+func TestReadMigrations(t *testing.T) {
+	var versions int
+	for _, d := range []string{"mysql", "postgres", "sqlite"} {
+		fsys, err := migrations.For(d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ms, err := ReadMigrations(fsys)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", d, err)
+		}
+		for i, m := range ms {
+			if m.Version != i+1 {
+				t.Errorf("%s: expected migration %d, got %d_%s", d, i+1, m.Version, m.Name)
+			}
+		}
+		if versions != 0 && len(ms) != versions {
+			t.Errorf("%s: expected every dialect to have %d migrations, got %d", d, versions, len(ms))
+		}
+		versions = len(ms)
+	}
+	broken := fstest.MapFS{
+		"0001_songs.up.sql": {Data: []byte("CREATE TABLE Songs (id int);")},
+	}
+	if _, err := ReadMigrations(broken); err == nil {
+		t.Errorf("expected an error for a migration without down")
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := "-- a comment\nCREATE TABLE a (\n  id int\n);\n\nINSERT INTO a VALUES (1);\nDROP TABLE b"
+	got := statements(sql)
+	if len(got) != 3 || got[0] != "CREATE TABLE a (\n  id int\n);" || got[2] != "DROP TABLE b" {
+		t.Errorf("unexpected statements: %q", got)
+	}
+}
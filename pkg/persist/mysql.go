@@ -1,53 +1,153 @@
 package persist
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"time"
 
 	"github.com/pclavier92/go-restful-api/config"
 	"github.com/pclavier92/go-restful-api/pkg/logs"
-
-	// just importing mysql driver for the side effects :)
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
 )
 
 // Querier is anything that can persist things and can tell us if there is something already there
 type Querier interface {
+	Executor
 	Query(q string, args ...interface{}) (*Rows, error)
 	QueryRow(q string, arg ...interface{}) *Row
 	Begin() (*Tx, error)
 	Exec(q string, args ...interface{}) (Result, error)
-	RowExists(where string, conditions string, args ...interface{}) bool
+	RowExists(table string, condition Pred) bool
+	WithTx(ctx context.Context, fn func(tx *Tx) error) error
+	WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx *Tx) error) error
+	StmtStats() StmtStats
+}
+
+// Executor runs queries. Both a Conn and a Tx are one, so repositories
+// can run the same code in and out of a transaction.
+type Executor interface {
+	QueryContext(ctx context.Context, q string, args ...interface{}) (*Rows, error)
+	QueryRowContext(ctx context.Context, q string, args ...interface{}) *Row
+	ExecContext(ctx context.Context, q string, args ...interface{}) (Result, error)
+	Dialect() Dialect
 }
 
 // Conn holds a connection to the database
 type Conn struct {
-	sql *sql.DB
-	Log logs.Printer
+	sql     *sql.DB
+	Log     logs.Printer
+	dialect Dialect
+	stmts   *stmtCache
+	obs     *observer
+	// replicas take the reads, see Primary to read your own writes
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
 }
 
-// NewWithCustom lets you pass a custom *sql.DB to create a connection
+// NewWithCustom lets you pass a custom *sql.DB, talking MySQL, to create a connection
 func NewWithCustom(sql *sql.DB, logger logs.Printer) *Conn {
-	return &Conn{sql, logger}
+	return &Conn{sql: sql, Log: logger, dialect: mysqlDialect{}, obs: newObserver(mysqlDialect{}, logger)}
 }
 
-// New returns a new connectoin to the database with the defauly mysql connector
+// NewWithDialect lets you pass a custom *sql.DB talking the dialect d
+func NewWithDialect(sql *sql.DB, d Dialect, logger logs.Printer) *Conn {
+	return &Conn{sql: sql, Log: logger, dialect: d, obs: newObserver(d, logger)}
+}
+
+// New returns a new connection to the database with the driver in cfg.DBDriver
 func New(cfg config.H, logger logs.Printer) (*Conn, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8",
-		cfg.DBUser,
-		cfg.DBPass,
-		cfg.DBHost,
-		cfg.DBName)
-	mysql, err := sql.Open("mysql", dsn)
+	d, err := DialectFor(cfg.DBDriver)
 	if err != nil {
 		return nil, err
 	}
-	if err := mysql.Ping(); err != nil {
+	if err := registerTLS(cfg, d); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(d.Driver(), d.DSN(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := connect(db, cfg, logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+	replicas, err := openReplicas(cfg, d)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	mysql.SetMaxOpenConns(5)
-	mysql.SetMaxIdleConns(5)
-	return &Conn{mysql, logger}, nil
+	c := &Conn{sql: db, Log: logger, dialect: d, obs: newObserver(d, logger), replicas: replicas, stop: make(chan struct{})}
+	c.SetPool(cfg.DBMaxOpenConns, cfg.DBMaxIdleConns)
+	c.SetConnLifetime(cfg.DBConnMaxLifetime, cfg.DBConnMaxIdleTime)
+	c.SetSlowQuery(cfg.DBSlowQueryThreshold)
+	c.CacheStatements(cfg.DBStmtCacheSize)
+	if len(replicas) > 0 {
+		go c.checkReplicas(c.stop)
+	}
+	return c, nil
+}
+
+// Dialect returns the dialect of the database
+func (c *Conn) Dialect() Dialect {
+	return c.dialect
+}
+
+// SetPool changes the size of the connection pool, of the primary and of
+// each replica. It is safe to call while the connection is in use.
+func (c *Conn) SetPool(maxOpen, maxIdle int) {
+	for _, db := range c.pools() {
+		db.SetMaxOpenConns(maxOpen)
+		db.SetMaxIdleConns(maxIdle)
+	}
+}
+
+// SetConnLifetime changes how long connections are used, and kept idle,
+// before being closed, 0 for ever. It is safe to call while the connection
+// is in use.
+func (c *Conn) SetConnLifetime(maxLifetime, maxIdleTime time.Duration) {
+	for _, db := range c.pools() {
+		db.SetConnMaxLifetime(maxLifetime)
+		db.SetConnMaxIdleTime(maxIdleTime)
+	}
+}
+
+// pools returns the pool of the primary and the ones of the replicas
+func (c *Conn) pools() []*sql.DB {
+	dbs := []*sql.DB{c.sql}
+	for _, r := range c.replicas {
+		dbs = append(dbs, r.sql)
+	}
+	return dbs
+}
+
+// connect pings the database, retrying cfg.DBConnectRetries times, as it
+// may still be starting, like when everything comes up with docker compose
+func connect(db *sql.DB, cfg config.H, logger logs.Printer) error {
+	backoff := cfg.DBConnectBackoff
+	for attempt := 0; ; attempt++ {
+		err := db.Ping()
+		if err == nil || attempt >= cfg.DBConnectRetries {
+			return err
+		}
+		logger.Warn("Could not connect to the database, retrying", logs.I{
+			"attempt": attempt + 1,
+			"wait":    backoff.String(),
+			"error":   err.Error(),
+		})
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Close closes every connection, to the primary and to the replicas
+func (c *Conn) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	closeReplicas(c.replicas)
+	return c.sql.Close()
 }
 
 // NullString is a string which may be null on the database
@@ -62,13 +162,18 @@ type Stmt struct {
 
 // Tx represents a transaction in the DB
 type Tx struct {
-	t *sql.Tx
-	l logs.Printer
+	t     *sql.Tx
+	l     logs.Printer
+	d     Dialect
+	stmts *stmtCache
+	obs   *observer
+	// bound are the statements of the cache bound to this transaction
+	bound map[string]*sql.Stmt
 }
 
 // Prepare will prepare a query
 func (t *Tx) Prepare(q string) (*Stmt, error) {
-	s, e := t.t.Prepare(q)
+	s, e := t.t.Prepare(t.d.Rebind(q))
 	return &Stmt{s}, e
 }
 
@@ -79,7 +184,7 @@ func (t *Tx) Commit() error {
 
 // Exec something on the transaction
 func (t *Tx) Exec(q string, args ...interface{}) (Result, error) {
-	r, err := t.t.Exec(q, args...)
+	r, err := t.t.Exec(t.d.Rebind(q), args...)
 	return Result{r}, err
 }
 
@@ -91,7 +196,7 @@ func (t *Tx) Rollback(original error) {
 		msg = original.Error()
 	}
 	if err := t.t.Rollback(); err != nil {
-		t.l.Info("There was a problem rollbacking!", logs.I{
+		t.l.Error("There was a problem rollbacking!", logs.I{
 			"error":    err.Error(),
 			"original": msg,
 		},
@@ -113,10 +218,10 @@ type Rows struct {
 // Close will avoid further quering about the rows
 func (r *Rows) Close() {
 	if err := r.r.Close(); err != nil {
-		r.l.Info("Error closing rows", logs.I{"err": err.Error()})
+		r.l.Warn("Error closing rows", logs.I{"err": err.Error()})
 	}
 	if err := r.r.Err(); err != nil {
-		r.l.Info("Error when traversing rows", logs.I{"err": err.Error()})
+		r.l.Error("Error when traversing rows", logs.I{"err": err.Error()})
 	}
 }
 
@@ -149,39 +254,132 @@ func (r *Rows) Scan(dest ...interface{}) error {
 	return err
 }
 
-// Row represents a single row from the DB
+// Row represents a single row from the DB. The span of its query ends on
+// Scan, so it records the errors of the row too.
 type Row struct {
 	*sql.Row
+	span *trace.Span
+}
+
+// Scan will write the row values into the provided go variables, like
+// sql.Row.Scan. A missing row is not taken as an error of the query.
+func (r *Row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if !IsNoRows(err) {
+		r.span.SetError(err)
+	}
+	r.span.End()
+	return err
 }
 
 // Query the DB.
 func (c *Conn) Query(q string, args ...interface{}) (*Rows, error) {
-	rws, err := c.sql.Query(q, args...)
+	return c.QueryContext(context.Background(), q, args...)
+}
+
+// QueryContext queries the DB, tracing the query as a child of the span in ctx.
+// It reads from a replica, if there are any and ctx is not Primary.
+func (c *Conn) QueryContext(ctx context.Context, q string, args ...interface{}) (*Rows, error) {
+	ctx, span := startSpan(ctx, c.dialect, "query", q)
+	defer span.End()
+	start := time.Now()
+	db, cache, r := c.reader(ctx)
+	setReplica(span, r)
+	bound := c.dialect.Rebind(q)
+	st, err := prepared(ctx, cache, bound)
+	var rws *sql.Rows
+	switch {
+	case err != nil:
+	case st == nil:
+		rws, err = db.QueryContext(ctx, bound, args...)
+	default:
+		rws, err = st.s.QueryContext(ctx, args...)
+		cache.put(st, err)
+	}
+	c.failed(r, err)
+	c.obs.done("query", q, start, err)
+	span.SetError(err)
 	return &Rows{rws, c.Log}, err
 }
 
 // QueryRow queries the DB about something which has to return ONE row.
 func (c *Conn) QueryRow(q string, args ...interface{}) *Row {
-	return &Row{c.sql.QueryRow(q, args...)}
+	return c.QueryRowContext(context.Background(), q, args...)
+}
+
+// QueryRowContext is QueryRow, tracing the query as a child of the span in ctx
+// until the row is scanned.
+// It reads from a replica, if there are any and ctx is not Primary.
+func (c *Conn) QueryRowContext(ctx context.Context, q string, args ...interface{}) *Row {
+	ctx, span := startSpan(ctx, c.dialect, "query_row", q)
+	start := time.Now()
+	db, cache, r := c.reader(ctx)
+	setReplica(span, r)
+	bound := c.dialect.Rebind(q)
+	var row *sql.Row
+	if st, err := prepared(ctx, cache, bound); err != nil || st == nil {
+		// the error of the prepare shows up, like any other, on Scan
+		row = db.QueryRowContext(ctx, bound, args...)
+	} else {
+		row = st.s.QueryRowContext(ctx, args...)
+		cache.put(st, row.Err())
+	}
+	c.failed(r, row.Err())
+	c.obs.done("query_row", q, start, row.Err())
+	return &Row{row, span}
 }
 
 // Begin a transaction.
 func (c *Conn) Begin() (*Tx, error) {
 	tx, err := c.sql.Begin()
-	return &Tx{tx, c.Log}, err
+	return &Tx{t: tx, l: c.Log, d: c.dialect, stmts: c.stmts, obs: c.obs}, err
 }
 
 // Exec will run the query inmediatly and return a result.
 func (c *Conn) Exec(q string, args ...interface{}) (Result, error) {
-	r, err := c.sql.Exec(q, args...)
+	return c.ExecContext(context.Background(), q, args...)
+}
+
+// ExecContext is Exec, tracing the query as a child of the span in ctx.
+func (c *Conn) ExecContext(ctx context.Context, q string, args ...interface{}) (Result, error) {
+	ctx, span := startSpan(ctx, c.dialect, "exec", q)
+	defer span.End()
+	start := time.Now()
+	bound := c.dialect.Rebind(q)
+	st, err := prepared(ctx, c.stmts, bound)
+	var r sql.Result
+	switch {
+	case err != nil:
+	case st == nil:
+		r, err = c.sql.ExecContext(ctx, bound, args...)
+	default:
+		r, err = st.s.ExecContext(ctx, args...)
+		c.stmts.put(st, err)
+	}
+	c.obs.done("exec", q, start, err)
+	span.SetError(err)
 	return Result{r}, err
 }
 
-// RowExists will tell you if the specified row exists in the "where" table, matching the condition string.
-func (c *Conn) RowExists(where string, condition string, args ...interface{}) bool {
+// setReplica records on span which replica the query went to
+func setReplica(span *trace.Span, r *replica) {
+	if r != nil {
+		span.SetAttr("db.replica", r.host)
+	}
+}
+
+// startSpan will start a client span for a query, never recording its arguments
+func startSpan(ctx context.Context, d Dialect, op, q string) (context.Context, *trace.Span) {
+	ctx, span := trace.StartKind(ctx, "persist."+op, trace.KindClient)
+	span.SetAttr("db.system", d.Name()).SetAttr("db.statement", d.Sanitize(q))
+	return ctx, span
+}
+
+// RowExists will tell you if a row matching the condition exists in the table
+func (c *Conn) RowExists(table string, condition Pred) bool {
 	var exists bool
-	query := fmt.Sprintf("SELECT exists (SELECT 1 FROM %s WHERE %s)", where, condition)
-	err := c.QueryRow(query, args...).Scan(&exists)
+	q, args := Select().From(table).Where(condition).Build(c.dialect)
+	err := c.QueryRow("SELECT EXISTS ("+q+")", args...).Scan(&exists)
 	if err != nil && err != sql.ErrNoRows {
 		return true
 	}
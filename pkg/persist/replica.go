@@ -0,0 +1,152 @@
+package persist
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+// ReplicaCheckInterval is how often the replicas are pinged to know if
+// they can take reads
+var ReplicaCheckInterval = 5 * time.Second
+
+// replica is a read only copy of the database
+type replica struct {
+	host    string
+	sql     *sql.DB
+	stmts   *stmtCache
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// setHealthy tells if the replica was healthy before
+func (r *replica) setHealthy(ok bool) bool {
+	v := int32(0)
+	if ok {
+		v = 1
+	}
+	return atomic.SwapInt32(&r.healthy, v) == 1
+}
+
+type primaryKey struct{}
+
+// Primary returns a context whose reads go to the primary, not to the
+// replicas, so they see the writes made right before. Replicas are a few
+// milliseconds, or seconds if things go bad, behind the primary.
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func isPrimary(ctx context.Context) bool {
+	p, _ := ctx.Value(primaryKey{}).(bool)
+	return p
+}
+
+// openReplicas connects to every host in cfg.DBReplicas, with the user,
+// password and database of the primary
+func openReplicas(cfg config.H, d Dialect) ([]*replica, error) {
+	if len(cfg.DBReplicas) > 0 && d.Name() == "sqlite" {
+		return nil, errors.New("sqlite has no replicas")
+	}
+	var rs []*replica
+	for _, host := range cfg.DBReplicas {
+		rcfg := cfg
+		rcfg.DBHost = host
+		db, err := sql.Open(d.Driver(), d.DSN(rcfg))
+		if err != nil {
+			closeReplicas(rs)
+			return nil, fmt.Errorf("replica %s: %v", host, err)
+		}
+		r := &replica{host: host, sql: db}
+		// a replica which is down when we start is only ejected,
+		// the primary can take the reads until it comes back
+		r.setHealthy(db.Ping() == nil)
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func closeReplicas(rs []*replica) {
+	for _, r := range rs {
+		r.sql.Close()
+	}
+}
+
+// reader returns where to read from: the next healthy replica, or the
+// primary when there is none or ctx asks for it
+func (c *Conn) reader(ctx context.Context) (*sql.DB, *stmtCache, *replica) {
+	if len(c.replicas) == 0 || isPrimary(ctx) {
+		return c.sql, c.stmts, nil
+	}
+	n := len(c.replicas)
+	start := int(atomic.AddUint32(&c.next, 1))
+	for i := 0; i < n; i++ {
+		r := c.replicas[(start+i)%n]
+		if r.isHealthy() {
+			return r.sql, r.stmts, r
+		}
+	}
+	return c.sql, c.stmts, nil
+}
+
+// failed ejects r if err says its connection is broken. The health check
+// brings it back once it answers again.
+func (c *Conn) failed(r *replica, err error) {
+	if r == nil || err == nil || !isBadConn(err) {
+		return
+	}
+	if r.setHealthy(false) {
+		c.Log.Warn("Replica ejected", logs.I{"replica": r.host, "error": err.Error()})
+	}
+}
+
+// checkReplicas pings every replica each ReplicaCheckInterval until stop is
+// closed, ejecting the ones which don't answer and bringing back the ones
+// which do
+func (c *Conn) checkReplicas(stop <-chan struct{}) {
+	t := time.NewTicker(ReplicaCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		for _, r := range c.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), ReplicaCheckInterval/2)
+			err := r.sql.PingContext(ctx)
+			cancel()
+			was := r.setHealthy(err == nil)
+			switch {
+			case err != nil && was:
+				c.Log.Warn("Replica ejected", logs.I{"replica": r.host, "error": err.Error()})
+			case err == nil && !was:
+				c.Log.Info("Replica is back", logs.I{"replica": r.host})
+			}
+		}
+	}
+}
+
+// ReplicaStatus tells if a replica is taking reads
+type ReplicaStatus struct {
+	Host    string `json:"host"`
+	Healthy bool   `json:"healthy"`
+}
+
+// Replicas returns the status of every replica
+func (c *Conn) Replicas() []ReplicaStatus {
+	var s []ReplicaStatus
+	for _, r := range c.replicas {
+		s = append(s, ReplicaStatus{r.host, r.isHealthy()})
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package persist
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs/logstest"
+)
+
+func TestReplicas(t *testing.T) {
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := db.Exec("CREATE TABLE Hosts (name VARCHAR(256))"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO Hosts (name) VALUES (?)", name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return db
+	}
+	c := NewWithDialect(open("primary"), sqliteDialect{}, logstest.New())
+	c.replicas = []*replica{{host: "r1", sql: open("r1")}, {host: "r2", sql: open("r2")}}
+	for _, r := range c.replicas {
+		r.setHealthy(true)
+	}
+	c.CacheStatements(10)
+	defer c.Close()
+
+	read := func(ctx context.Context) string {
+		var name string
+		if err := c.QueryRowContext(ctx, "SELECT name FROM Hosts").Scan(&name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return name
+	}
+	ctx := context.Background()
+	if a, b := read(ctx), read(ctx); a == b || a == "primary" || b == "primary" {
+		t.Errorf("expected the reads to go round the replicas, got %s and %s", a, b)
+	}
+	if h := read(Primary(ctx)); h != "primary" {
+		t.Errorf("expected to read from the primary, got %s", h)
+	}
+	if _, err := c.Exec("UPDATE Hosts SET name = ?", "written"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := read(Primary(ctx)); h != "written" {
+		t.Errorf("expected the write to go to the primary, got %s", h)
+	}
+	c.replicas[0].setHealthy(false)
+	if a, b := read(ctx), read(ctx); a != "r2" || b != "r2" {
+		t.Errorf("expected the ejected replica to take no reads, got %s and %s", a, b)
+	}
+	c.replicas[1].setHealthy(false)
+	if h := read(ctx); h != "written" {
+		t.Errorf("expected the primary to take the reads with no replica left, got %s", h)
+	}
+	if s := c.Replicas(); len(s) != 2 || s[0].Healthy || s[1].Healthy {
+		t.Errorf("expected both replicas to be down, got %+v", s)
+	}
+}
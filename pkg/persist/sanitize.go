@@ -0,0 +1,92 @@
+package persist
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sanitize will return the query with every literal replaced by a ? and
+// all whitespace collapsed, keeping placeholders like $1, so it can be logged or traced without leaking data.
+// It takes " as a string, like MySQL does: use the Sanitize of the Dialect
+// for the databases where it quotes identifiers.
+func Sanitize(q string) string {
+	return sanitize(q, '`')
+}
+
+// sanitize is Sanitize for a database quoting identifiers with ident,
+// which are kept as they are
+func sanitize(q string, ident byte) string {
+	var b strings.Builder
+	b.Grow(len(q))
+	space := false
+	for i := 0; i < len(q); i++ {
+		ch := q[i]
+		switch {
+		case ch == ident:
+			// keep the whole quoted identifier, digits included
+			end := len(q)
+			if j := strings.IndexByte(q[i+1:], ident); j >= 0 {
+				end = i + j + 2
+			}
+			writeSpace(&b, &space)
+			b.WriteString(q[i:end])
+			i = end - 1
+		case ch == '\'' || ch == '"':
+			// skip the whole quoted literal, honoring doubled and escaped quotes
+			for i++; i < len(q); i++ {
+				if q[i] == '\\' {
+					i++
+					continue
+				}
+				if q[i] == ch {
+					if i+1 < len(q) && q[i+1] == ch {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			writeSpace(&b, &space)
+			b.WriteByte('?')
+		case ch == '$' && i+1 < len(q) && isDigit(q[i+1]):
+			// keep the placeholders of PostgreSQL, they are not literals
+			end := i + 1
+			for end < len(q) && isDigit(q[end]) {
+				end++
+			}
+			writeSpace(&b, &space)
+			b.WriteString(q[i:end])
+			i = end - 1
+		case ch >= '0' && ch <= '9' && !partOfIdent(q, i):
+			for i+1 < len(q) && (isDigit(q[i+1]) || q[i+1] == '.') {
+				i++
+			}
+			writeSpace(&b, &space)
+			b.WriteByte('?')
+		case unicode.IsSpace(rune(ch)):
+			space = b.Len() > 0
+		default:
+			writeSpace(&b, &space)
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func writeSpace(b *strings.Builder, space *bool) {
+	if *space {
+		b.WriteByte(' ')
+		*space = false
+	}
+}
+
+func isDigit(ch byte) bool { return ch >= '0' && ch <= '9' }
+
+// partOfIdent tells if the digit in q[i] is inside an identifier like artist_id2
+func partOfIdent(q string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	p := q[i-1]
+	return p == '_' || p == '`' || isDigit(p) || unicode.IsLetter(rune(p))
+}
@@ -0,0 +1,27 @@
+package persist
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	q := `SELECT "Songs"."name2" FROM "Songs" WHERE name = 'it''s' AND duration > 3`
+	cases := map[Dialect]string{
+		mysqlDialect{}:    `SELECT ?.? FROM ? WHERE name = ? AND duration > ?`,
+		postgresDialect{}: `SELECT "Songs"."name2" FROM "Songs" WHERE name = ? AND duration > ?`,
+		sqliteDialect{}:   `SELECT "Songs"."name2" FROM "Songs" WHERE name = ? AND duration > ?`,
+	}
+	for d, want := range cases {
+		if got := d.Sanitize(q); got != want {
+			t.Errorf("%s: expected %q, got %q", d.Name(), want, got)
+		}
+	}
+	q = `SELECT name FROM Songs WHERE name = $1 AND duration > 3 LIMIT $12`
+	want := `SELECT name FROM Songs WHERE name = $1 AND duration > ? LIMIT $12`
+	if got := (postgresDialect{}).Sanitize(q); got != want {
+		t.Errorf("expected the placeholders to be kept, got %q", got)
+	}
+	q = "SELECT `name2` FROM Songs WHERE  artist_id2 = 42 AND name = \"x\""
+	want = "SELECT `name2` FROM Songs WHERE artist_id2 = ? AND name = ?"
+	if got := Sanitize(q); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,109 @@
+package persist
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldIndexes caches the index of the field of each column, by struct type
+var fieldIndexes sync.Map
+
+// columnsOf returns the field index of every column of the struct type t.
+// The column is the db tag of the field, or its name, in lower case as
+// columns are matched ignoring the case. Fields tagged db:"-" are skipped,
+// and embedded structs are mapped as if their fields were in t.
+func columnsOf(t reflect.Type) map[string][]int {
+	if m, ok := fieldIndexes.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for col, idx := range columnsOf(f.Type) {
+				m[col] = append([]int{i}, idx...)
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		m[strings.ToLower(tag)] = []int{i}
+	}
+	fieldIndexes.Store(t, m)
+	return m
+}
+
+// targets returns pointers to the fields of v for each of the columns
+func targets(v reflect.Value, cols []string) ([]interface{}, error) {
+	fields := columnsOf(v.Type())
+	dest := make([]interface{}, len(cols))
+	for i, col := range cols {
+		idx, ok := fields[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("column %s has no field in %s, tag one with db:\"%s\"", col, v.Type(), col)
+		}
+		dest[i] = v.FieldByIndex(idx).Addr().Interface()
+	}
+	return dest, nil
+}
+
+// ScanStruct will write the current row into the struct dest points to,
+// matching the columns with its db tags. Use a sql.Scanner, like NullString,
+// or a pointer for fields which may be null. It fails if any column has no
+// field, and like Scan, closes the rows if anything goes wrong.
+func (r *Rows) ScanStruct(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		r.Close()
+		return fmt.Errorf("ScanStruct needs a pointer to a struct, got %T", dest)
+	}
+	cols, err := r.r.Columns()
+	if err != nil {
+		r.Close()
+		return err
+	}
+	fields, err := targets(v.Elem(), cols)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	return r.Scan(fields...)
+}
+
+// ScanAll will write every row into the slice of structs, or of pointers to
+// structs, dest points to, see ScanStruct. The rows are closed when done.
+func (r *Rows) ScanAll(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		r.Close()
+		return fmt.Errorf("ScanAll needs a pointer to a slice, got %T", dest)
+	}
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		r.Close()
+		return fmt.Errorf("ScanAll needs a slice of structs, got %T", dest)
+	}
+	for r.Next() {
+		item := reflect.New(elem)
+		if err := r.ScanStruct(item.Interface()); err != nil {
+			return err
+		}
+		if !isPtr {
+			item = item.Elem()
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+	return r.Err()
+}
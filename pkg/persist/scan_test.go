@@ -0,0 +1,49 @@
+package persist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/config"
+)
+
+type base struct {
+	ID int `db:"id"`
+}
+
+type scanned struct {
+	base
+	Name     string
+	Duration NullString `db:"duration"`
+	Artist   *string    `db:"ArtistName"` // mixed case, matched like any column
+	Ignored  string     `db:"-"`
+}
+
+func TestScanAll(t *testing.T) {
+	c, _ := newTestConn(t, config.H{},
+		"CREATE TABLE s (id INTEGER, name TEXT, duration TEXT, artistName TEXT)",
+		"INSERT INTO s VALUES (1, 'one', '3:00', 'someone'), (2, 'two', NULL, NULL)",
+	)
+	rows, err := c.Query("SELECT artistName, duration, name, id FROM s ORDER BY id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []scanned
+	if err := rows.ScanAll(&got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != 1 || got[0].Name != "one" || got[0].Duration.String != "3:00" || *got[0].Artist != "someone" {
+		t.Errorf("unexpected first row: %+v", got)
+	}
+	if got[1].Duration.Valid || got[1].Artist != nil {
+		t.Errorf("expected nulls in the second row, got: %+v", got[1])
+	}
+	rows, err = c.Query("SELECT id, 1 AS extra FROM s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ptrs []*scanned
+	if err := rows.ScanAll(&ptrs); err == nil || !strings.Contains(err.Error(), "column extra") {
+		t.Errorf("expected an error for the unmapped column, got: %v", err)
+	}
+}
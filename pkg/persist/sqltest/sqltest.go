@@ -129,7 +129,7 @@ func (db *DB) ExpectRowExists(res bool) {
 }
 
 // RowExists will tell you if a row exists according to the config of the tester
-func (db *DB) RowExists(where string, conditions string, args ...interface{}) bool {
+func (db *DB) RowExists(table string, condition persist.Pred) bool {
 	r := db.truer[db.rowExistsCount]
 	db.rowExistsCount++
 	return r
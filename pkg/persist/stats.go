@@ -0,0 +1,191 @@
+package persist
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+)
+
+const (
+	// samples is how many of the last durations of each statement are kept
+	// for the percentiles
+	samples = 512
+	// maxStatements keeps a query building its SQL on the fly from taking
+	// all the memory, the statements after it are counted together
+	maxStatements   = 1000
+	otherStatements = "(other)"
+)
+
+// QueryStat tells how a statement has been doing since the stats were reset.
+// The durations are in milliseconds, and only cover running the query, not
+// going through its rows.
+type QueryStat struct {
+	SQL    string  `json:"sql"`
+	Count  uint64  `json:"count"`
+	Errors uint64  `json:"errors"`
+	Total  float64 `json:"totalMs"`
+	Mean   float64 `json:"meanMs"`
+	P50    float64 `json:"p50Ms"`
+	P95    float64 `json:"p95Ms"`
+	P99    float64 `json:"p99Ms"`
+	Max    float64 `json:"maxMs"`
+}
+
+type statement struct {
+	count, errors uint64
+	total, max    time.Duration
+	// last is a ring with the last durations
+	last []time.Duration
+	next int
+}
+
+func (s *statement) add(d time.Duration, failed bool) {
+	s.count++
+	if failed {
+		s.errors++
+	}
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+	if len(s.last) < samples {
+		s.last = append(s.last, d)
+		return
+	}
+	s.last[s.next] = d
+	s.next = (s.next + 1) % samples
+}
+
+func (s *statement) stat(sql string) QueryStat {
+	sorted := append([]time.Duration{}, s.last...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	pct := func(p float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return ms(sorted[int(p*float64(len(sorted)-1))])
+	}
+	return QueryStat{
+		SQL:    sql,
+		Count:  s.count,
+		Errors: s.errors,
+		Total:  ms(s.total),
+		Mean:   ms(s.total / time.Duration(s.count)),
+		P50:    pct(0.50),
+		P95:    pct(0.95),
+		P99:    pct(0.99),
+		Max:    ms(s.max),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// observer times every query, keeping stats by statement and logging the
+// slow ones
+type observer struct {
+	log  logs.Printer
+	d    Dialect
+	slow int64 // time.Duration, 0 logs none
+	mu   sync.Mutex
+	byQ  map[string]*statement
+}
+
+func newObserver(d Dialect, log logs.Printer) *observer {
+	return &observer{log: log, d: d, byQ: map[string]*statement{}}
+}
+
+// done records a query q, which started at start, ran by op. The stats
+// are kept by the sanitized SQL, so queries only differing on their
+// literals count as one.
+func (o *observer) done(op, q string, start time.Time, err error) {
+	d := time.Since(start)
+	sql := o.d.Sanitize(q)
+	o.mu.Lock()
+	s, ok := o.byQ[sql]
+	if !ok {
+		key := sql
+		if len(o.byQ) >= maxStatements {
+			key = otherStatements
+		}
+		if s, ok = o.byQ[key]; !ok {
+			s = &statement{}
+			o.byQ[key] = s
+		}
+	}
+	s.add(d, err != nil && !IsNoRows(err))
+	o.mu.Unlock()
+
+	if slow := time.Duration(atomic.LoadInt64(&o.slow)); slow > 0 && d >= slow {
+		o.log.Warn("Slow query", logs.I{
+			"op":       op,
+			"sql":      sql,
+			"duration": ms(d),
+			"caller":   caller(),
+		})
+	}
+}
+
+func (o *observer) stats() []QueryStat {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := make([]QueryStat, 0, len(o.byQ))
+	for sql, s := range o.byQ {
+		stats = append(stats, s.stat(sql))
+	}
+	// the ones which take the most time first, those are the ones that hurt
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Total > stats[j].Total })
+	return stats
+}
+
+func (o *observer) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.byQ = map[string]*statement{}
+}
+
+// persistPkg is the prefix of the functions of this package
+var persistPkg = reflect.TypeOf(Conn{}).PkgPath() + "."
+
+// caller returns where the query was made from: the first function out
+// of this package, like songs.go:195 (songs.db.Get)
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, persistPkg) {
+			return fmt.Sprintf("%s:%d (%s)", path.Base(f.File), f.Line, path.Base(f.Function))
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// SetSlowQuery logs every query taking threshold or more, 0 logs none.
+// It is safe to call while the connection is in use.
+func (c *Conn) SetSlowQuery(threshold time.Duration) {
+	atomic.StoreInt64(&c.obs.slow, int64(threshold))
+}
+
+// QueryStats returns the stats of every statement run since the last
+// ResetQueryStats, the ones taking the most time first
+func (c *Conn) QueryStats() []QueryStat {
+	return c.obs.stats()
+}
+
+// ResetQueryStats forgets every stat, to start measuring again
+func (c *Conn) ResetQueryStats() {
+	c.obs.reset()
+}
@@ -0,0 +1,65 @@
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/config"
+)
+
+func TestQueryStats(t *testing.T) {
+	c, log := newTestConn(t, config.H{}, "CREATE TABLE Albums (name VARCHAR(256))")
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := c.ExecContext(ctx, "INSERT INTO Albums (name) VALUES ('"+name+"')"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := c.Exec("INSERT INTO Nowhere (name) VALUES ('x')"); err == nil {
+		t.Fatalf("expected an error inserting into a missing table")
+	}
+	var name string
+	if err := c.QueryRow("SELECT name FROM Albums WHERE name = ?", "z").Scan(&name); !IsNoRows(err) {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+	stats := map[string]QueryStat{}
+	for _, s := range c.QueryStats() {
+		stats[s.SQL] = s
+	}
+	if s := stats["INSERT INTO Albums (name) VALUES (?)"]; s.Count != 3 || s.Errors != 0 || s.P99 < s.P50 || s.Max < s.P99 {
+		t.Errorf("expected the inserts to be counted together, got %+v", stats)
+	}
+	if s := stats["INSERT INTO Nowhere (name) VALUES (?)"]; s.Count != 1 || s.Errors != 1 {
+		t.Errorf("expected the failed insert to be counted as an error, got %+v", s)
+	}
+	if s := stats["SELECT name FROM Albums WHERE name = ?"]; s.Count != 1 || s.Errors != 0 {
+		t.Errorf("expected no rows not to be an error, got %+v", s)
+	}
+	if _, ok := log.Find("warn", "Slow query"); ok {
+		t.Errorf("expected no slow queries without a threshold")
+	}
+	c.SetSlowQuery(time.Nanosecond)
+	c.Exec("DELETE FROM Albums")
+	slow, ok := log.Find("warn", "Slow query")
+	if !ok || slow.Fields["sql"] != "DELETE FROM Albums" {
+		t.Fatalf("expected the delete to be logged as slow, got %+v", slow)
+	}
+	if caller, _ := slow.Fields["caller"].(string); caller == "" || caller == "unknown" {
+		t.Errorf("expected the caller of the query, got %q", caller)
+	}
+	c.ResetQueryStats()
+	if s := c.QueryStats(); len(s) != 0 {
+		t.Errorf("expected no stats after a reset, got %+v", s)
+	}
+
+	// the queries are counted as they were written, not as they were bound
+	c.dialect, c.obs.d = postgresDialect{}, postgresDialect{}
+	c.SetSlowQuery(0)
+	if err := c.QueryRow("SELECT name FROM Albums WHERE name = ? LIMIT ?", "a", 1).Scan(&name); !IsNoRows(err) {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+	if s := c.QueryStats(); len(s) != 1 || s[0].SQL != "SELECT name FROM Albums WHERE name = ? LIMIT ?" {
+		t.Errorf("expected the query without its PostgreSQL placeholders, got %+v", s)
+	}
+}
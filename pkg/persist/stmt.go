@@ -0,0 +1,262 @@
+package persist
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// StmtStats tells how well the cache of prepared statements is doing
+type StmtStats struct {
+	// Size is how many statements are prepared now, and Capacity how many can be
+	Size     int `json:"size"`
+	Capacity int `json:"capacity"`
+	// Hits are the queries which found their statement already prepared
+	Hits uint64 `json:"hits"`
+	// Misses are the queries which had to prepare it
+	Misses uint64 `json:"misses"`
+	// Evictions are the statements closed to make room for others
+	Evictions uint64 `json:"evictions"`
+	// Invalidations are the statements closed because the database dropped them
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// HitRate is the fraction of the queries which found their statement prepared
+func (s StmtStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// stmt is a statement of the cache. It is only closed once nobody uses it,
+// so evicting it never breaks a query which already got it.
+type stmt struct {
+	s       *sql.Stmt
+	q       string
+	refs    int
+	evicted bool
+}
+
+// stmtCache keeps the last used prepared statements, by their (rebound) SQL.
+// database/sql prepares them again on every connection of the pool they
+// end up running on, so we only have to care about how many we keep.
+type stmtCache struct {
+	db    *sql.DB
+	size  int
+	mu    sync.Mutex
+	lru   *list.List // of *stmt, the most recently used first
+	byQ   map[string]*list.Element
+	stats StmtStats
+}
+
+func newStmtCache(db *sql.DB, size int) *stmtCache {
+	return &stmtCache{
+		db:   db,
+		size: size,
+		lru:  list.New(),
+		byQ:  map[string]*list.Element{},
+	}
+}
+
+// cacheable tells if q is worth preparing. Schema changes and admin
+// statements run once in a while, and an insert of many rows has a new
+// text for each number of rows, with up to thousands of placeholders, so
+// they would only push the hot queries out of the cache.
+func cacheable(q string) bool {
+	verb := strings.ToUpper(strings.SplitN(strings.TrimSpace(q), " ", 2)[0])
+	switch verb {
+	case "SELECT", "UPDATE", "DELETE", "WITH":
+		return true
+	case "INSERT", "REPLACE":
+		return !manyRows.MatchString(q)
+	}
+	return false
+}
+
+// manyRows matches the VALUES of an insert of more than one row
+var manyRows = regexp.MustCompile(`(?i)\bVALUES\s*\(.*?\)\s*,\s*\(`)
+
+// lookup returns the statement for q if it is prepared already, or nil.
+// It never goes to the database. The statement must be given back with
+// put once the query has run.
+func (c *stmtCache) lookup(q string) *stmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.byQ[q]; ok {
+		c.lru.MoveToFront(e)
+		st := e.Value.(*stmt)
+		st.refs++
+		c.stats.Hits++
+		return st
+	}
+	c.stats.Misses++
+	return nil
+}
+
+// get returns the statement for q, preparing it if needed, which takes a
+// connection of the pool. The statement must be given back with put once
+// the query has run.
+func (c *stmtCache) get(ctx context.Context, q string) (*stmt, error) {
+	if st := c.lookup(q); st != nil {
+		return st, nil
+	}
+	// prepared without the lock, as it goes to the database
+	s, err := c.db.PrepareContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.byQ[q]; ok {
+		// someone else prepared it meanwhile, keep theirs
+		s.Close()
+		st := e.Value.(*stmt)
+		st.refs++
+		return st, nil
+	}
+	st := &stmt{s: s, q: q, refs: 1}
+	c.byQ[q] = c.lru.PushFront(st)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+	return st, nil
+}
+
+// put gives back a statement got from get. If err says the database
+// doesn't know the statement anymore, it is dropped from the cache.
+func (c *stmtCache) put(st *stmt, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil && isStale(err) && !st.evicted {
+		c.remove(c.byQ[st.q])
+		c.stats.Invalidations++
+	}
+	st.refs--
+	if st.evicted && st.refs == 0 {
+		st.s.Close()
+	}
+}
+
+// invalidate drops the statement of q, which the database doesn't know
+// anymore, from the cache
+func (c *stmtCache) invalidate(q string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.byQ[q]; ok {
+		c.remove(e)
+		c.stats.Invalidations++
+	}
+}
+
+// remove takes e out of the cache, closing it if nobody is using it
+func (c *stmtCache) remove(e *list.Element) {
+	st := c.lru.Remove(e).(*stmt)
+	delete(c.byQ, st.q)
+	st.evicted = true
+	if st.refs == 0 {
+		st.s.Close()
+	}
+}
+
+// Stats returns how the cache is doing
+func (c *stmtCache) Stats() StmtStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.lru.Len()
+	s.Capacity = c.size
+	return s
+}
+
+// CacheStatements keeps up to size prepared statements, on the primary
+// and on each replica, so the queries run most often are parsed only once.
+// 0 turns the cache off, which is the default for connections not made by
+// New. Call it before using c.
+func (c *Conn) CacheStatements(size int) {
+	c.stmts = nil
+	for _, r := range c.replicas {
+		r.stmts = nil
+	}
+	if size <= 0 {
+		return
+	}
+	c.stmts = newStmtCache(c.sql, size)
+	for _, r := range c.replicas {
+		r.stmts = newStmtCache(r.sql, size)
+	}
+}
+
+// StmtStats tells how well the cache of prepared statements is doing, adding
+// up the primary and the replicas. It is empty when there is no cache.
+func (c *Conn) StmtStats() StmtStats {
+	if c.stmts == nil {
+		return StmtStats{}
+	}
+	s := c.stmts.Stats()
+	for _, r := range c.replicas {
+		rs := r.stmts.Stats()
+		s.Size += rs.Size
+		s.Capacity += rs.Capacity
+		s.Hits += rs.Hits
+		s.Misses += rs.Misses
+		s.Evictions += rs.Evictions
+		s.Invalidations += rs.Invalidations
+	}
+	return s
+}
+
+// prepared returns the statement of cache for q, which is already rebound,
+// or nil if q is not cached and must run as is
+func prepared(ctx context.Context, cache *stmtCache, q string) (*stmt, error) {
+	if cache == nil || !cacheable(q) {
+		return nil, nil
+	}
+	return cache.get(ctx, q)
+}
+
+// stmt returns the statement for q in the transaction, once per transaction.
+// The statements of the cache are bound to it with Tx.Stmt. The ones which
+// are not there are prepared on the transaction and left out of the cache:
+// preparing them for the cache would wait for a second connection of the
+// pool while holding this one, which never comes when the pool is full of
+// transactions doing the same.
+func (t *Tx) stmt(ctx context.Context, q string) (*sql.Stmt, error) {
+	if t.stmts == nil || !cacheable(q) {
+		return nil, nil
+	}
+	if s, ok := t.bound[q]; ok {
+		return s, nil
+	}
+	var s *sql.Stmt
+	if st := t.stmts.lookup(q); st != nil {
+		// the statement of the transaction is closed with it, not with st
+		s = t.t.StmtContext(ctx, st.s)
+		t.stmts.put(st, nil)
+	} else {
+		var err error
+		if s, err = t.t.PrepareContext(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	if t.bound == nil {
+		t.bound = map[string]*sql.Stmt{}
+	}
+	t.bound[q] = s
+	return s, nil
+}
+
+// failed forgets the statement of q, in the transaction and in the cache,
+// if err says the database doesn't know it anymore, like Conn does
+func (t *Tx) failed(q string, err error) {
+	if t.stmts == nil || err == nil || !isStale(err) {
+		return
+	}
+	delete(t.bound, q)
+	t.stmts.invalidate(q)
+}
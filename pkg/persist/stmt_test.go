@@ -0,0 +1,119 @@
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pclavier92/go-restful-api/config"
+)
+
+func TestStmtCache(t *testing.T) {
+	c, _ := newTestConn(t, config.H{DBMaxOpenConns: 2, DBMaxIdleConns: 2, DBStmtCacheSize: 2},
+		"CREATE TABLE Plays (name VARCHAR(256) PRIMARY KEY, n INTEGER)")
+	ctx := context.Background()
+	if s := c.StmtStats(); s.Misses != 0 || s.Size != 0 {
+		t.Errorf("expected schema changes not to be cached, got %+v", s)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Exec("INSERT INTO Plays (name, n) VALUES (?, ?)", string(rune('a'+i)), i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var n int
+	if err := c.QueryRow("SELECT n FROM Plays WHERE name = ?", "b").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected 1, got %d: %v", n, err)
+	}
+	rows, err := c.Query("SELECT name FROM Plays")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.QueryRow("SELECT n FROM Plays WHERE name = ?", "c").Scan(&n); err != nil || n != 2 {
+		t.Errorf("expected 2, got %d: %v", n, err)
+	}
+	// evicts the statement of the open rows, which keep working
+	if err := c.QueryRow("SELECT COUNT(*) FROM Plays").Scan(&n); err != nil || n != 3 {
+		t.Errorf("expected 3, got %d: %v", n, err)
+	}
+	names := 0
+	for rows.Next() {
+		names++
+	}
+	if names != 3 {
+		t.Errorf("expected 3 names, got %d: %v", names, rows.Err())
+	}
+	err = c.WithTx(ctx, func(tx *Tx) error {
+		for i := 0; i < 2; i++ {
+			if _, err := tx.ExecContext(ctx, "UPDATE Plays SET n = n + 1 WHERE name = ?", "a"); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx, "SELECT n FROM Plays WHERE name = ?", "a").Scan(&n)
+	})
+	if err != nil || n != 2 {
+		t.Errorf("expected 2, got %d: %v", n, err)
+	}
+	s := c.StmtStats()
+	// the transaction looks each of its statements up only once, and
+	// prepares the update on its own connection, out of the cache
+	expected := StmtStats{Size: 2, Capacity: 2, Hits: 4, Misses: 5, Evictions: 2}
+	if s != expected {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+	if s.HitRate() != 4.0/9 {
+		t.Errorf("expected a hit rate of 4/9, got %v", s.HitRate())
+	}
+}
+
+// TestStmtCacheTx runs transactions on a pool of a single connection, which
+// they hold, so they must never wait for another one to prepare statements
+func TestStmtCacheTx(t *testing.T) {
+	c, _ := newTestConn(t, config.H{DBStmtCacheSize: 10}, "CREATE TABLE Plays (name VARCHAR(256) PRIMARY KEY, n INTEGER)")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	insert := "INSERT INTO Plays (name, n) VALUES (?, ?)"
+	err := c.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, insert, "a", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// prepared into the cache out of the transaction, then bound to the next
+	if _, err := c.ExecContext(ctx, insert, "b", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = c.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, insert, "c", 3); err != nil {
+			return err
+		}
+		// the database forgot the statement
+		tx.failed(insert, &mysql.MySQLError{Number: errUnknownStmt})
+		_, err := tx.ExecContext(ctx, insert, "d", 4)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := StmtStats{Size: 0, Capacity: 10, Hits: 1, Misses: 3, Invalidations: 1}
+	if s := c.StmtStats(); s != expected {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	cases := map[string]bool{
+		"SELECT n FROM Plays WHERE name = ?":                                                               true,
+		"  with x AS (SELECT 1) SELECT * FROM x":                                                           true,
+		"INSERT INTO Plays (name, n) VALUES (?, ?)":                                                        true,
+		"INSERT INTO Plays (name, n) VALUES ($1, $2), ($3, $4)":                                            false,
+		"INSERT INTO Plays (name, n) VALUES (?, ?),(?, ?) ON CONFLICT (name) DO UPDATE SET n = excluded.n": false,
+		"CREATE TABLE Plays (name VARCHAR(256))":                                                           false,
+	}
+	for q, want := range cases {
+		if got := cacheable(q); got != want {
+			t.Errorf("%s: expected %v, got %v", q, want, got)
+		}
+	}
+}
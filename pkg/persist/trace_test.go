@@ -0,0 +1,36 @@
+package persist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclavier92/go-restful-api/config"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+type spans []trace.Data
+
+func (s *spans) Export(d trace.Data) error {
+	*s = append(*s, d)
+	return nil
+}
+
+func TestQueryRowSpan(t *testing.T) {
+	c, _ := newTestConn(t, config.H{}, "CREATE TABLE Singles (name VARCHAR(256))")
+	exported := &spans{}
+	ctx, root := trace.New("test", exported).Start(context.Background(), "test", trace.KindInternal)
+	var n int
+	if err := c.QueryRowContext(ctx, "SELECT name FROM Singles").Scan(&n); !IsNoRows(err) {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+	if err := c.QueryRowContext(ctx, "SELECT COUNT(*) FROM Nowhere").Scan(&n); err == nil {
+		t.Fatalf("expected an error querying a missing table")
+	}
+	root.End()
+	if len(*exported) != 3 {
+		t.Fatalf("expected the spans to end on Scan, got %+v", *exported)
+	}
+	if missing, failed := (*exported)[0], (*exported)[1]; missing.Error || !failed.Error || failed.StatusMsg == "" {
+		t.Errorf("expected only the error of the second row to be recorded, got %+v and %+v", missing, failed)
+	}
+}
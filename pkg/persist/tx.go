@@ -0,0 +1,143 @@
+package persist
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pclavier92/go-restful-api/pkg/logs"
+	"github.com/pclavier92/go-restful-api/pkg/trace"
+)
+
+// TxOptions says how to run a transaction
+type TxOptions struct {
+	// Isolation is the isolation level, the default of the database when zero
+	Isolation sql.IsolationLevel
+	// ReadOnly transactions can't change anything
+	ReadOnly bool
+	// Retries is how many times the transaction is run again after a
+	// deadlock or a lock wait timeout, see IsRetryable
+	Retries int
+	// Backoff is the wait before the first retry, doubled on every other one
+	Backoff time.Duration
+}
+
+// DefaultTxOptions are used by WithTx
+var DefaultTxOptions = TxOptions{Retries: 3, Backoff: 20 * time.Millisecond}
+
+// WithTx runs fn in a transaction, with the DefaultTxOptions. The transaction
+// is committed if fn returns nil, and rolled back if it returns an error or
+// panics. As fn may run more than once it must not have other side effects.
+func (c *Conn) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return c.WithTxOptions(ctx, DefaultTxOptions, fn)
+}
+
+// WithTxOptions is like WithTx, but lets you choose how the transaction runs
+func (c *Conn) WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx *Tx) error) error {
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.runTx(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) || attempt >= opts.Retries {
+			return err
+		}
+		c.Log.Warn("Retrying transaction", logs.I{"attempt": attempt + 1, "error": err.Error()})
+		// some jitter, so the transactions which clashed don't clash again
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Conn) runTx(ctx context.Context, opts TxOptions, fn func(tx *Tx) error) (err error) {
+	ctx, span := trace.StartKind(ctx, "persist.tx", trace.KindClient)
+	span.SetAttr("db.system", c.dialect.Name()).SetAttr("db.readOnly", opts.ReadOnly)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	t, err := c.sql.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return err
+	}
+	tx := &Tx{t: t, l: c.Log, d: c.dialect, stmts: c.stmts, obs: c.obs}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("transaction panicked: %v", p)
+			tx.Rollback(err)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback(err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryContext queries the DB inside the transaction
+func (t *Tx) QueryContext(ctx context.Context, q string, args ...interface{}) (*Rows, error) {
+	ctx, span := startSpan(ctx, t.d, "query", q)
+	defer span.End()
+	start := time.Now()
+	bound := t.d.Rebind(q)
+	s, err := t.stmt(ctx, bound)
+	var rws *sql.Rows
+	switch {
+	case err != nil:
+	case s == nil:
+		rws, err = t.t.QueryContext(ctx, bound, args...)
+	default:
+		rws, err = s.QueryContext(ctx, args...)
+		t.failed(bound, err)
+	}
+	t.obs.done("query", q, start, err)
+	span.SetError(err)
+	return &Rows{rws, t.l}, err
+}
+
+// QueryRowContext queries the DB, inside the transaction, about something which has to return ONE row
+func (t *Tx) QueryRowContext(ctx context.Context, q string, args ...interface{}) *Row {
+	ctx, span := startSpan(ctx, t.d, "query_row", q)
+	start := time.Now()
+	bound := t.d.Rebind(q)
+	var row *sql.Row
+	if s, err := t.stmt(ctx, bound); err == nil && s != nil {
+		row = s.QueryRowContext(ctx, args...)
+		t.failed(bound, row.Err())
+	} else {
+		row = t.t.QueryRowContext(ctx, bound, args...)
+	}
+	t.obs.done("query_row", q, start, row.Err())
+	return &Row{row, span}
+}
+
+// ExecContext runs the query inside the transaction
+func (t *Tx) ExecContext(ctx context.Context, q string, args ...interface{}) (Result, error) {
+	ctx, span := startSpan(ctx, t.d, "exec", q)
+	defer span.End()
+	start := time.Now()
+	bound := t.d.Rebind(q)
+	s, err := t.stmt(ctx, bound)
+	var r sql.Result
+	switch {
+	case err != nil:
+	case s == nil:
+		r, err = t.t.ExecContext(ctx, bound, args...)
+	default:
+		r, err = s.ExecContext(ctx, args...)
+		t.failed(bound, err)
+	}
+	t.obs.done("exec", q, start, err)
+	span.SetError(err)
+	return Result{r}, err
+}
+
+// Dialect returns the dialect of the database
+func (t *Tx) Dialect() Dialect {
+	return t.d
+}
@@ -0,0 +1,50 @@
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pclavier92/go-restful-api/config"
+)
+
+func TestWithTx(t *testing.T) {
+	c, _ := newTestConn(t, config.H{}, "CREATE TABLE Counters (name VARCHAR(256) PRIMARY KEY, n INTEGER)")
+	ctx := context.Background()
+	insert := func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO Counters (name, n) VALUES (?, ?)", "a", 1)
+		return err
+	}
+	if err := c.WithTx(ctx, func(tx *Tx) error { insert(tx); panic("boom") }); err == nil {
+		t.Errorf("expected the panic to be returned as an error")
+	}
+	if c.RowExists("Counters", Eq("name", "a")) {
+		t.Errorf("expected the panicking transaction to be rolled back")
+	}
+	attempts := 0
+	opts := TxOptions{Retries: 2, Backoff: time.Millisecond}
+	err := c.WithTxOptions(ctx, opts, func(tx *Tx) error {
+		attempts++
+		if err := insert(tx); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return &mysql.MySQLError{Number: errLockDeadlock, Message: "Deadlock found"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("expected to commit on the third attempt, got %d: %v", attempts, err)
+	}
+	var n int
+	if err := c.QueryRow("SELECT COUNT(*) FROM Counters").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected only the last attempt to be committed, got %d: %v", n, err)
+	}
+	err = c.WithTxOptions(ctx, TxOptions{ReadOnly: true}, func(tx *Tx) error {
+		return tx.QueryRowContext(ctx, "SELECT n FROM Counters WHERE name = ?", "a").Scan(&n)
+	})
+	if err != nil || n != 1 {
+		t.Errorf("expected to read in a read only transaction, got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exporter is anything that can ship finished spans somewhere
+type Exporter interface {
+	Export(d Data) error
+}
+
+// NopExporter throws every span away
+type NopExporter struct{}
+
+// Export does nothing
+func (NopExporter) Export(Data) error { return nil }
+
+// WriterExporter writes every span as a JSON line to an io.Writer.
+// It needs no network, so it works fine offline.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewWriterExporter returns an exporter writing JSON lines to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutExporter returns an exporter writing to the standard output
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter returns an exporter appending spans to the file in path
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	e := NewWriterExporter(f)
+	e.c = f
+	return e, nil
+}
+
+// Export writes the span
+func (e *WriterExporter) Export(d Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(d)
+}
+
+// Close will close the underlying file, if there is one
+func (e *WriterExporter) Close() error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+// NewExporter returns an exporter from its name in the config:
+// "stdout", "file:<path>" or "" for no exporter at all.
+func NewExporter(output string) (Exporter, error) {
+	switch {
+	case output == "" || output == "none":
+		return NopExporter{}, nil
+	case output == "stdout":
+		return NewStdoutExporter(), nil
+	case len(output) > len("file:") && output[:len("file:")] == "file:":
+		return NewFileExporter(output[len("file:"):])
+	}
+	return nil, &UnknownExporterError{output}
+}
+
+// UnknownExporterError is returned when the config names an exporter we don't have
+type UnknownExporterError struct {
+	Output string
+}
+
+func (e *UnknownExporterError) Error() string {
+	return "unknown trace exporter: " + e.Output
+}
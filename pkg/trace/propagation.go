@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Header is the W3C header used to propagate the span context
+const Header = "traceparent"
+
+// Parse will read a W3C traceparent header, with the format
+// version-traceid-spanid-flags. ok is false if the header is invalid.
+func Parse(h string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if !decodeHex(traceID, sc.TraceID[:]) || !decodeHex(spanID, sc.SpanID[:]) {
+		return SpanContext{}, false
+	}
+	var f [1]byte
+	if !decodeHex(flags, f[:]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = f[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Format will write the span context as a W3C traceparent header
+func Format(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
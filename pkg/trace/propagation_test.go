@@ -0,0 +1,40 @@
+package trace
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := Parse(header)
+	if !ok {
+		t.Fatalf("expected %s to be a valid traceparent", header)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("wrong trace id, got: %s", sc.TraceID)
+	}
+	if sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("wrong span id, got: %s", sc.SpanID)
+	}
+	if !sc.Sampled {
+		t.Errorf("expected span context to be sampled")
+	}
+	if got := Format(sc); got != header {
+		t.Errorf("format is not what we expected, got:\n %s\n wanted:\n %s", got, header)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, h := range invalid {
+		if _, ok := Parse(h); ok {
+			t.Errorf("expected %q to be an invalid traceparent", h)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a whole trace, shared by every span in it
+type TraceID [16]byte
+
+// String returns the hex representation of the trace id
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid is false for the all zeroes trace id
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a single span inside a trace
+type SpanID [8]byte
+
+// String returns the hex representation of the span id
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid is false for the all zeroes span id
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span which travels between processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid tells you if both ids of the span context are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind says what role the span plays in the trace
+type Kind string
+
+// Span kinds we use around the API
+const (
+	KindInternal Kind = "internal"
+	KindServer   Kind = "server"
+	KindClient   Kind = "client"
+)
+
+// Tracer creates spans and hands them to an exporter once finished
+type Tracer struct {
+	service  string
+	exporter Exporter
+}
+
+// New returns a tracer for a service which will export its spans to exp
+func New(service string, exp Exporter) *Tracer {
+	if exp == nil {
+		exp = NopExporter{}
+	}
+	return &Tracer{service, exp}
+}
+
+// Start will create a new span. If ctx already carries a span, the new one
+// will be its child, otherwise it will be the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := spanContextFrom(ctx)
+	return t.start(ctx, name, kind, parent)
+}
+
+// StartRemote will create a span whose parent lives in another process,
+// usually the result of parsing a traceparent header.
+func (t *Tracer) StartRemote(ctx context.Context, name string, kind Kind, parent SpanContext) (context.Context, *Span) {
+	return t.start(ctx, name, kind, parent)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind Kind, parent SpanContext) (context.Context, *Span) {
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+	}
+	s := &Span{
+		tracer: t,
+		data: Data{
+			Service: t.service,
+			Name:    name,
+			Kind:    kind,
+			TraceID: sc.TraceID.String(),
+			SpanID:  sc.SpanID.String(),
+			Start:   time.Now(),
+			Attrs:   map[string]interface{}{},
+		},
+		sc: sc,
+	}
+	if parent.SpanID.IsValid() {
+		s.data.ParentID = parent.SpanID.String()
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Start creates a child of the span found in ctx, using the same tracer.
+// When ctx carries no span it returns a no-op span, so code can always
+// call Start without caring if tracing is on.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind is like Start but lets you choose the kind of the span.
+func StartKind(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent := FromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+// Span is a single timed operation inside a trace. A nil *Span is valid
+// and does nothing, which is what Start returns when tracing is off.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	mu     sync.Mutex
+	data   Data
+	ended  bool
+}
+
+// Data is the finished information of a span, ready to be exported
+type Data struct {
+	Service   string                 `json:"service"`
+	Name      string                 `json:"name"`
+	Kind      Kind                   `json:"kind"`
+	TraceID   string                 `json:"traceId"`
+	SpanID    string                 `json:"spanId"`
+	ParentID  string                 `json:"parentId,omitempty"`
+	Start     time.Time              `json:"start"`
+	End       time.Time              `json:"end"`
+	Duration  time.Duration          `json:"durationNs"`
+	Attrs     map[string]interface{} `json:"attributes,omitempty"`
+	Error     bool                   `json:"error"`
+	StatusMsg string                 `json:"status,omitempty"`
+}
+
+// Context returns the span context, for propagating it elsewhere
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr will add an attribute to the span
+func (s *Span) SetAttr(key string, v interface{}) *Span {
+	if s == nil {
+		return s
+	}
+	s.mu.Lock()
+	s.data.Attrs[key] = v
+	s.mu.Unlock()
+	return s
+}
+
+// SetError will mark the span as failed if err is not nil
+func (s *Span) SetError(err error) *Span {
+	if s == nil || err == nil {
+		return s
+	}
+	s.mu.Lock()
+	s.data.Error = true
+	s.data.StatusMsg = err.Error()
+	s.mu.Unlock()
+	return s
+}
+
+// End will finish the span and export it. Calling End twice does nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Duration = s.data.End.Sub(s.data.Start)
+	d := s.data
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		_ = s.tracer.exporter.Export(d)
+	}
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span in ctx, or nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func spanContextFrom(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.sc
+	}
+	return SpanContext{}
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		_, _ = rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		_, _ = rand.Read(s[:])
+	}
+	return s
+}